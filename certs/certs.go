@@ -0,0 +1,146 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader is used to serve a certificate, and optionally verify client certificates, from files on disk
+// that can be replaced without restarting.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.Mutex
+	modTimes  map[string]time.Time
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+}
+
+// New is used to create a reloader and load the files. The client CA file is optional.
+func New(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Gets the modification times of the files.
+func (r *Reloader) stat() (map[string]time.Time, error) {
+	m := map[string]time.Time{}
+	for _, f := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if f == "" {
+			continue
+		}
+		st, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		m[f] = st.ModTime()
+	}
+	return m, nil
+}
+
+// Reload is used to load the files from disk. If they cannot be loaded, the previous certificates are
+// kept so that a half-written file does not break the server.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Stat the files first so a change during the load is picked up next time.
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if r.clientCAFile != "" {
+		b, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return errors.New("Client CA file contains no certificates")
+		}
+	}
+
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	r.modTimes = modTimes
+	return nil
+}
+
+// Checks if any of the files have changed since they were loaded.
+func (r *Reloader) changed() bool {
+	modTimes, err := r.stat()
+	if err != nil {
+		// The file is probably being replaced.
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range modTimes {
+		if !v.Equal(r.modTimes[k]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch is used to reload the files when they change until the context is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			slog.Error("Error reloading certificates", "err", err)
+		} else {
+			slog.Info("Reloaded certificates")
+		}
+	}
+}
+
+// TLSConfig is used to get a TLS config that uses the current certificates for each handshake. If there
+// is a client CA, client certificates are verified if they are sent, and it is up to the handler to
+// require them.
+func (r *Reloader) TLSConfig(minVersion uint16) *tls.Config {
+	c := &tls.Config{
+		MinVersion: minVersion,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+	if r.clientCAFile != "" {
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+		c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			// Clone when the handshake happens so settings added when the server starts, such as the
+			// protocols for HTTP/2, are kept.
+			clone := c.Clone()
+			clone.GetConfigForClient = nil
+			clone.ClientCAs = r.clientCAs.Load()
+			return clone, nil
+		}
+	}
+	return c
+}
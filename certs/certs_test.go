@@ -0,0 +1,140 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a self-signed certificate and key with the common name to the files.
+func writeCert(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Gets the common name of the certificate being served.
+func servedName(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, err := r.TLSConfig(tls.VersionTLS12).GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+
+	r, err := New(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := servedName(t, r); name != "first" {
+		t.Fatalf("expected first, got %s", name)
+	}
+	if r.changed() {
+		t.Fatal("expected no change")
+	}
+
+	// Replace the certificate and make sure the change is noticed.
+	writeCert(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !r.changed() {
+		t.Fatal("expected a change")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if name := servedName(t, r); name != "second" {
+		t.Fatalf("expected second, got %s", name)
+	}
+
+	// A broken file should keep the previous certificate.
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if name := servedName(t, r); name != "second" {
+		t.Fatalf("expected second, got %s", name)
+	}
+}
+
+func TestReloaderClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	writeCert(t, certFile, keyFile, "server")
+	writeCert(t, caFile, filepath.Join(dir, "ca-key.pem"), "ca")
+
+	r, err := New(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.TLSConfig(tls.VersionTLS12).GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ClientAuth != tls.VerifyClientCertIfGiven || c.ClientCAs == nil {
+		t.Fatal("expected client certificates to be verified")
+	}
+
+	// A CA file without certificates should be rejected.
+	if err := os.WriteFile(caFile, []byte("empty"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"contenttruck/config"
+	"contenttruck/db"
+	"contenttruck/gc"
+)
+
+// Runs the gc command, which prints objects and file records that are no longer needed. If -delete is
+// set, they are removed. Returns the exit code.
+func gcCommand(conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	remove := flags.Bool("delete", false, "remove the garbage rather than only printing it")
+	rate := flags.Float64("rate", 10, "the maximum number of objects or records to remove per second, or 0 for no limit")
+	minAge := flags.Duration("min-age", 24*time.Hour, "how old objects and file records have to be to be collected")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Connect to the database and S3.
+	conn := db.NewDB(conf.PostgresConnectionString)
+	defer conn.Close()
+	c := &gc.Collector{DB: conn, S3: newS3Client(conf), Bucket: conf.BucketName, MinAge: *minAge, Rate: *rate}
+
+	// Make sure garbage is not being collected elsewhere.
+	ctx := context.Background()
+	unlock, ok, err := conn.TryLock(ctx, db.LockGC)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error taking garbage collection lock:", err)
+		return 1
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Garbage is already being collected")
+		return 1
+	}
+	defer unlock()
+
+	// Print each piece of garbage, and count it by kind.
+	counts := map[string]int{}
+	sizes := map[string]int64{}
+	failed := 0
+	err = c.Run(ctx, *remove, func(g *gc.Garbage, removed bool, err error) {
+		status := ""
+		switch {
+		case err != nil:
+			failed++
+			status = " (error: " + err.Error() + ")"
+		case *remove && !removed:
+			// It is no longer garbage.
+			return
+		case removed:
+			status = " (removed)"
+		}
+		counts[g.Kind]++
+		sizes[g.Kind] += g.Size
+		partitions := ""
+		if len(g.Partitions) != 0 {
+			partitions = " [" + strings.Join(g.Partitions, ", ") + "]"
+		}
+		fmt.Printf("%s: %s%s %d bytes%s\n", g.Kind, g.Path, partitions, g.Size, status)
+	})
+	for _, kind := range []string{gc.KindOrphanObject, gc.KindDanglingRecord, gc.KindDeletedPartition} {
+		fmt.Printf("%d %s (%d bytes)\n", counts[kind], kind, sizes[kind])
+	}
+	if !*remove && len(counts) != 0 {
+		fmt.Println("Run with -delete to remove them.")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error collecting garbage:", err)
+		return 1
+	}
+	if failed != 0 {
+		fmt.Fprintf(os.Stderr, "Failed to remove %d items.\n", failed)
+		return 1
+	}
+	return 0
+}
@@ -1,13 +1,30 @@
 package main
 
 import (
+	"context"
 	"crypto/subtle"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"contenttruck/certs"
 	"contenttruck/config"
 	"contenttruck/db"
+	"contenttruck/events"
 	"contenttruck/httpserver"
+	"contenttruck/jobs"
+	"contenttruck/metrics"
+	"contenttruck/reconcile"
+	"contenttruck/tracing"
+	"contenttruck/trash"
+	"contenttruck/validations/clamd"
+	"contenttruck/validations/validators"
+	"contenttruck/versions"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -16,6 +33,12 @@ import (
 	"golang.org/x/net/http2/h2c"
 )
 
+// Defines how often the certificate files are checked for changes.
+const certReloadInterval = 30 * time.Second
+
+// Defines how often expired files are purged from the trash.
+const trashSweepInterval = 10 * time.Minute
+
 func isSudoKey(key string) func(string) bool {
 	keyB := []byte(key)
 	return func(s string) bool {
@@ -23,6 +46,24 @@ func isSudoKey(key string) func(string) bool {
 	}
 }
 
+// Creates the S3 client and removes the credentials from the config.
+func newS3Client(conf *config.Config) *s3.S3 {
+	sess := session.Must(session.NewSessionWithOptions(
+		session.Options{
+			Config: aws.Config{
+				Endpoint: aws.String(conf.Endpoint),
+				Region:   aws.String(conf.Region),
+				Credentials: credentials.NewStaticCredentials(
+					conf.AccessKeyID, conf.SecretAccessKey, ""),
+			},
+		}))
+	conf.AccessKeyID = ""
+	conf.SecretAccessKey = ""
+	conf.Region = ""
+	conf.Endpoint = ""
+	return s3.New(sess)
+}
+
 func main() {
 	// Display the log.
 	fmt.Println("Contenttruck. Copyright (C) 2023 Web Scale Software Ltd.")
@@ -30,29 +71,124 @@ func main() {
 	// Load the config.
 	conf := config.NewConfig()
 
+	// Create the logger. Packages without a logger injected use the default.
+	logger := conf.NewLogger(os.Stderr)
+	slog.SetDefault(logger)
+
+	// Run the command if one is specified.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reconcile":
+			os.Exit(reconcileCommand(conf, os.Args[2:]))
+		case "gc":
+			os.Exit(gcCommand(conf, os.Args[2:]))
+		default:
+			fmt.Fprintln(os.Stderr, "Unknown command:", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
 	// Get the key comparer.
 	comparer := isSudoKey(conf.SudoKey)
 	conf.SudoKey = ""
 
+	// Export traces if a collector is configured.
+	shutdownTracing := func(context.Context) error { return nil }
+	if conf.TracingEndpoint != "" {
+		var err error
+		shutdownTracing, err = tracing.Setup(context.Background(), conf.TracingEndpoint, *conf.TracingSampleRatio)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// Connect to the database.
 	conn := db.NewDB(conf.PostgresConnectionString)
 	conf.PostgresConnectionString = ""
 
 	// Initialise the S3 client.
-	sess := session.Must(session.NewSessionWithOptions(
-		session.Options{
-			Config: aws.Config{
-				Endpoint: aws.String(conf.Endpoint),
-				Region:   aws.String(conf.Region),
-				Credentials: credentials.NewStaticCredentials(
-					conf.AccessKeyID, conf.SecretAccessKey, ""),
-			},
-		}))
-	s3Client := s3.New(sess)
-	conf.AccessKeyID = ""
-	conf.SecretAccessKey = ""
-	conf.Region = ""
-	conf.Endpoint = ""
+	s3Client := newS3Client(conf)
+	metrics.InstrumentS3(s3Client)
+	tracing.InstrumentS3(s3Client)
+
+	// Create the malware scanner client if it is configured.
+	var scanner *clamd.Client
+	if conf.ClamdAddress != "" {
+		var err error
+		scanner, err = clamd.New(conf.ClamdAddress, time.Duration(conf.ClamdTimeout))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Set up the validation hooks.
+	hooks := make(map[string]*validators.Hook, len(conf.ValidationHooks))
+	for name, v := range conf.ValidationHooks {
+		hooks[name] = &validators.Hook{
+			URL:         v.URL,
+			Secret:      v.Secret,
+			Timeout:     time.Duration(v.Timeout),
+			IncludeBody: v.IncludeBody,
+			FailOpen:    v.FailOpen,
+		}
+	}
+	validators.Validators = append(validators.Validators, validators.NewHookValidator(hooks))
+
+	// Defines the context that the background workers run until.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := sync.WaitGroup{}
+	runWorker := func(fn func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			fn(workerCtx)
+		}()
+	}
+
+	// Create the event publisher and start delivering webhooks.
+	publisher := &events.Publisher{DB: conn, Webhooks: conf.Webhooks}
+	runWorker(publisher.RunWebhooks)
+
+	// Start listening for events to stream.
+	broker := &events.Broker{DB: conn}
+	runWorker(broker.Run)
+
+	// Run the background jobs, such as deleting the files of deleted partitions.
+	jobRunner := &jobs.Runner{DB: conn, S3: s3Client, Bucket: conf.BucketName}
+	runWorker(jobRunner.Run)
+
+	// Purge files from the trash once they expire.
+	versionStore := &versions.Store{DB: conn, S3: s3Client, Bucket: conf.BucketName}
+	trashBin := &trash.Bin{DB: conn, S3: s3Client, Bucket: conf.BucketName, Versions: versionStore}
+	runWorker(func(ctx context.Context) {
+		trashBin.RunPeriodically(ctx, trashSweepInterval)
+	})
+
+	// Periodically reconcile the partition usage with storage if configured.
+	if conf.ReconcileInterval != 0 {
+		reconciler := &reconcile.Reconciler{DB: conn, S3: s3Client, Bucket: conf.BucketName}
+		runWorker(func(ctx context.Context) {
+			reconciler.RunPeriodically(ctx, time.Duration(conf.ReconcileInterval), conf.ReconcileFix)
+		})
+	}
+
+	// Serve the metrics on their own listener so they are not exposed publicly.
+	var metricsServer *http.Server
+	if conf.MetricsHost != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:              conf.MetricsHost,
+			Handler:           mux,
+			ReadHeaderTimeout: time.Duration(conf.ReadHeaderTimeout),
+		}
+		go func() {
+			err := metricsServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
 
 	// Create the HTTP server and listen.
 	s := &httpserver.Server{
@@ -60,9 +196,112 @@ func main() {
 		DB:               conn,
 		SudoKeyValidator: comparer,
 		S3:               s3Client,
+		Scanner:          scanner,
+		Events:           publisher,
+		Broker:           broker,
+		Jobs:             jobRunner,
+		Trash:            trashBin,
+		Versions:         versionStore,
+		Logger:           logger,
 	}
-	err := http.ListenAndServe(conf.HTTPHost, h2c.NewHandler(s, &http2.Server{}))
-	if err != nil {
+	h2s := &http2.Server{IdleTimeout: time.Duration(conf.IdleTimeout)}
+	httpServer := &http.Server{
+		Addr:              conf.HTTPHost,
+		Handler:           h2c.NewHandler(s, h2s),
+		ReadHeaderTimeout: time.Duration(conf.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(conf.ReadTimeout),
+		WriteTimeout:      time.Duration(conf.WriteTimeout),
+		IdleTimeout:       time.Duration(conf.IdleTimeout),
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	// Serve TLS if it is configured. The certificates are reloaded when the files change or on SIGHUP.
+	var reloader *certs.Reloader
+	if conf.TLSCertFile != "" {
+		var err error
+		reloader, err = certs.New(conf.TLSCertFile, conf.TLSKeyFile, conf.TLSClientCAFile)
+		if err != nil {
+			panic(err)
+		}
+		httpServer.TLSConfig = reloader.TLSConfig(config.TLSVersions[conf.TLSMinVersion])
+		runWorker(func(ctx context.Context) {
+			reloader.Watch(ctx, certReloadInterval)
+		})
+	}
+	if err := http2.ConfigureServer(httpServer, h2s); err != nil {
 		panic(err)
 	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if reloader != nil {
+			serveErr <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- httpServer.ListenAndServe()
+		}
+	}()
+
+	// Wait for a signal to shut down, reloading the certificates on SIGHUP.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for waiting := true; waiting; {
+		select {
+		case err := <-serveErr:
+			panic(err)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if reloader == nil {
+					continue
+				}
+				if err := reloader.Reload(); err != nil {
+					logger.Error("Error reloading certificates", "err", err)
+				} else {
+					logger.Info("Reloaded certificates")
+				}
+				continue
+			}
+			logger.Info("Shutting down", "signal", sig.String())
+			waiting = false
+		}
+	}
+
+	// Fail readiness, and give load balancers time to notice before we stop accepting requests.
+	s.MarkShuttingDown()
+	time.Sleep(time.Duration(conf.ShutdownDelay))
+
+	// Stop accepting requests and wait for the in-flight ones. If they take too long, close their
+	// connections, and give the handlers a moment to release the usage they reserved.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.ShutdownTimeout))
+	defer cancel()
+	err := httpServer.Shutdown(ctx)
+	if err == nil {
+		// HTTP/2 connections are hijacked by h2c, so Shutdown does not wait for them.
+		err = s.WaitInFlight(ctx)
+	}
+	if err != nil {
+		logger.Warn("Timed out waiting for requests to finish", "err", err)
+		_ = httpServer.Close()
+		waitCtx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+		if err = s.WaitInFlight(waitCtx); err != nil {
+			logger.Warn("Timed out waiting for handlers to finish", "err", err)
+		}
+		cancelWait()
+	}
+
+	// Stop the background workers.
+	stopWorkers()
+	workers.Wait()
+
+	// Flush the remaining spans and stop serving metrics.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Warn("Error flushing traces", "err", err)
+	}
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(flushCtx)
+	}
+
+	// Close the database connections.
+	conn.Close()
+	logger.Info("Shut down")
 }
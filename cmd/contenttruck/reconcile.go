@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"contenttruck/config"
+	"contenttruck/db"
+	"contenttruck/reconcile"
+)
+
+// Runs the reconcile command, which compares the usage and files recorded for each partition with
+// storage and prints the differences. If -fix is set, the records are corrected. Returns the exit code.
+func reconcileCommand(conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "correct the records to match storage")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Connect to the database and S3.
+	conn := db.NewDB(conf.PostgresConnectionString)
+	defer conn.Close()
+	r := &reconcile.Reconciler{DB: conn, S3: newS3Client(conf), Bucket: conf.BucketName}
+
+	// Make sure the background job is not reconciling at the same time.
+	ctx := context.Background()
+	unlock, ok, err := conn.TryLock(ctx, db.LockReconcile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error taking reconciliation lock:", err)
+		return 1
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Partitions are already being reconciled")
+		return 1
+	}
+	defer unlock()
+
+	// Print each partition that does not match.
+	n := 0
+	err = r.Run(ctx, *fix, func(d *reconcile.Discrepancy) {
+		n++
+		fmt.Printf("%s: recorded %d bytes in %d files, storage has %d bytes in %d files\n",
+			d.Partition, d.RecordedSize, d.RecordedFiles, d.ActualSize, d.ActualFiles)
+		for _, v := range d.MissingFiles {
+			fmt.Printf("  not recorded: %s\n", v)
+		}
+		for _, v := range d.StaleFiles {
+			fmt.Printf("  not in storage: %s\n", v)
+		}
+	})
+	switch {
+	case n == 0:
+		fmt.Println("All partitions match storage.")
+	case *fix:
+		fmt.Printf("Fixed %d partitions.\n", n)
+	default:
+		fmt.Printf("%d partitions do not match storage. Run with -fix to correct them.\n", n)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reconciling partitions:", err)
+		return 1
+	}
+	return 0
+}
@@ -1,20 +1,92 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 )
 
+// Duration is used to define a duration that is a string such as "30s" in the JSON config.
+type Duration time.Duration
+
+// UnmarshalJSON is used to parse the duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// TLSVersions is used to map the TLS versions that can be used in the config to their values.
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ValidationHook is used to define an external HTTP endpoint that can be used with "hook=<name>".
+type ValidationHook struct {
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret"`
+	Timeout     Duration `json:"timeout"`
+	IncludeBody bool     `json:"include_body"`
+	FailOpen    bool     `json:"fail_open"`
+}
+
+// Webhook is used to define a HTTP endpoint that events are delivered to. If partitions are specified,
+// only events for those partitions are delivered, and if events are specified, only those event types are.
+type Webhook struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	Partitions []string `json:"partitions"`
+	Events     []string `json:"events"`
+}
+
 type Config struct {
-	SecretAccessKey          string `json:"secret_access_key"`
-	AccessKeyID              string `json:"access_key_id"`
-	Region                   string `json:"region"`
-	BucketName               string `json:"bucket_name"`
-	Endpoint                 string `json:"endpoint"`
-	SudoKey                  string `json:"sudo_key"`
-	HTTPHost                 string `json:"http_host"`
-	PostgresConnectionString string `json:"postgres_connection_string"`
+	SecretAccessKey          string   `json:"secret_access_key"`
+	AccessKeyID              string   `json:"access_key_id"`
+	Region                   string   `json:"region"`
+	BucketName               string   `json:"bucket_name"`
+	Endpoint                 string   `json:"endpoint"`
+	SudoKey                  string   `json:"sudo_key"`
+	HTTPHost                 string   `json:"http_host"`
+	TLSCertFile              string   `json:"tls_cert_file"`
+	TLSKeyFile               string   `json:"tls_key_file"`
+	TLSClientCAFile          string   `json:"tls_client_ca_file"`
+	TLSMinVersion            string   `json:"tls_min_version"`
+	ReadHeaderTimeout        Duration `json:"read_header_timeout"`
+	ReadTimeout              Duration `json:"read_timeout"`
+	WriteTimeout             Duration `json:"write_timeout"`
+	IdleTimeout              Duration `json:"idle_timeout"`
+	ShutdownDelay            Duration `json:"shutdown_delay"`
+	ShutdownTimeout          Duration `json:"shutdown_timeout"`
+	MetricsHost              string   `json:"metrics_host"`
+	LogFormat                string   `json:"log_format"`
+	LogLevel                 string   `json:"log_level"`
+	TracingEndpoint          string   `json:"tracing_endpoint"`
+	TracingSampleRatio       *float64 `json:"tracing_sample_ratio"`
+	PostgresConnectionString string   `json:"postgres_connection_string"`
+	ClamdAddress             string   `json:"clamd_address"`
+	ClamdTimeout             Duration `json:"clamd_timeout"`
+	ClamdFailOpen            bool     `json:"clamd_fail_open"`
+	TrustProxyHeaders        bool     `json:"trust_proxy_headers"`
+	ReconcileInterval        Duration `json:"reconcile_interval"`
+	ReconcileFix             bool     `json:"reconcile_fix"`
+
+	ValidationHooks map[string]*ValidationHook `json:"validation_hooks"`
+	Webhooks        []*Webhook                 `json:"webhooks"`
 }
 
 func loadConfigJson() *Config {
@@ -39,6 +111,30 @@ type pair[A, B any] struct {
 	a1 B
 }
 
+func parseDuration(name, s string) Duration {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		panic(name + " is not a valid duration: " + err.Error())
+	}
+	return Duration(v)
+}
+
+func parseFloat(name, s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic(name + " is not a valid number: " + err.Error())
+	}
+	return v
+}
+
+func parseBool(name, s string) bool {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		panic(name + " is not a valid boolean: " + err.Error())
+	}
+	return v
+}
+
 func validate(pairs ...pair[string, string]) {
 	for _, v := range pairs {
 		if v.a1 == "" {
@@ -83,10 +179,154 @@ func NewConfig() *Config {
 	if conf.HTTPHost == "" {
 		conf.HTTPHost = "0.0.0.0:6050"
 	}
+	for _, v := range []struct {
+		env string
+		ptr *string
+	}{
+		{"TLS_CERT_FILE", &conf.TLSCertFile},
+		{"TLS_KEY_FILE", &conf.TLSKeyFile},
+		{"TLS_CLIENT_CA_FILE", &conf.TLSClientCAFile},
+		{"TLS_MIN_VERSION", &conf.TLSMinVersion},
+	} {
+		e = os.Getenv(v.env)
+		if e != "" {
+			*v.ptr = e
+		}
+	}
+	if (conf.TLSCertFile == "") != (conf.TLSKeyFile == "") {
+		panic("TLS_CERT_FILE and TLS_KEY_FILE must be specified together")
+	}
+	if conf.TLSClientCAFile != "" && conf.TLSCertFile == "" {
+		panic("TLS_CLIENT_CA_FILE needs TLS to be enabled")
+	}
+	if conf.TLSMinVersion == "" {
+		conf.TLSMinVersion = "1.2"
+	}
+	if _, ok := TLSVersions[conf.TLSMinVersion]; !ok {
+		panic("TLS_MIN_VERSION must be 1.0, 1.1, 1.2 or 1.3")
+	}
+	durations := []struct {
+		env string
+		ptr *Duration
+		def time.Duration
+	}{
+		{"READ_HEADER_TIMEOUT", &conf.ReadHeaderTimeout, 10 * time.Second},
+		{"READ_TIMEOUT", &conf.ReadTimeout, 0},
+		{"WRITE_TIMEOUT", &conf.WriteTimeout, 0},
+		{"IDLE_TIMEOUT", &conf.IdleTimeout, 2 * time.Minute},
+		{"SHUTDOWN_DELAY", &conf.ShutdownDelay, 0},
+		{"SHUTDOWN_TIMEOUT", &conf.ShutdownTimeout, 30 * time.Second},
+		{"RECONCILE_INTERVAL", &conf.ReconcileInterval, 0},
+	}
+	for _, v := range durations {
+		e = os.Getenv(v.env)
+		if e != "" {
+			*v.ptr = parseDuration(v.env, e)
+		}
+		if *v.ptr == 0 {
+			*v.ptr = Duration(v.def)
+		}
+	}
+	e = os.Getenv("METRICS_HOST")
+	if e != "" {
+		conf.MetricsHost = e
+	}
+	e = os.Getenv("LOG_FORMAT")
+	if e != "" {
+		conf.LogFormat = e
+	}
+	switch conf.LogFormat {
+	case "":
+		conf.LogFormat = "json"
+	case "json", "logfmt":
+	default:
+		panic("log format must be json or logfmt")
+	}
+	e = os.Getenv("LOG_LEVEL")
+	if e != "" {
+		conf.LogLevel = e
+	}
+	if conf.LogLevel == "" {
+		conf.LogLevel = "info"
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(conf.LogLevel)); err != nil {
+		panic("log level is not valid: " + err.Error())
+	}
+	e = os.Getenv("TRACING_ENDPOINT")
+	if e != "" {
+		conf.TracingEndpoint = e
+	}
+	e = os.Getenv("TRACING_SAMPLE_RATIO")
+	if e != "" {
+		v := parseFloat("TRACING_SAMPLE_RATIO", e)
+		conf.TracingSampleRatio = &v
+	}
+	if conf.TracingSampleRatio == nil {
+		v := 1.0
+		conf.TracingSampleRatio = &v
+	} else if *conf.TracingSampleRatio < 0 || *conf.TracingSampleRatio > 1 {
+		panic("tracing sample ratio must be between 0 and 1")
+	}
 	e = os.Getenv("POSTGRES_CONNECTION_STRING")
 	if e != "" {
 		conf.PostgresConnectionString = e
 	}
+	e = os.Getenv("CLAMD_ADDRESS")
+	if e != "" {
+		conf.ClamdAddress = e
+	}
+	e = os.Getenv("CLAMD_TIMEOUT")
+	if e != "" {
+		conf.ClamdTimeout = parseDuration("CLAMD_TIMEOUT", e)
+	}
+	if conf.ClamdTimeout == 0 {
+		conf.ClamdTimeout = Duration(time.Minute)
+	}
+	e = os.Getenv("CLAMD_FAIL_OPEN")
+	if e != "" {
+		conf.ClamdFailOpen = parseBool("CLAMD_FAIL_OPEN", e)
+	}
+	e = os.Getenv("TRUST_PROXY_HEADERS")
+	if e != "" {
+		conf.TrustProxyHeaders = parseBool("TRUST_PROXY_HEADERS", e)
+	}
+	e = os.Getenv("RECONCILE_FIX")
+	if e != "" {
+		conf.ReconcileFix = parseBool("RECONCILE_FIX", e)
+	}
+	e = os.Getenv("VALIDATION_HOOKS")
+	if e != "" {
+		conf.ValidationHooks = nil
+		if err := json.Unmarshal([]byte(e), &conf.ValidationHooks); err != nil {
+			panic("VALIDATION_HOOKS is not valid JSON: " + err.Error())
+		}
+	}
+	e = os.Getenv("WEBHOOKS")
+	if e != "" {
+		conf.Webhooks = nil
+		if err := json.Unmarshal([]byte(e), &conf.Webhooks); err != nil {
+			panic("WEBHOOKS is not valid JSON: " + err.Error())
+		}
+	}
+	webhookNames := map[string]bool{}
+	for _, v := range conf.Webhooks {
+		if v.Name == "" || v.URL == "" {
+			panic("webhooks must have a name and URL")
+		}
+		if webhookNames[v.Name] {
+			panic("webhook " + v.Name + " is specified more than once")
+		}
+		webhookNames[v.Name] = true
+	}
+	for name, v := range conf.ValidationHooks {
+		if v.URL == "" {
+			panic("validation hook " + name + " has no URL")
+		}
+		if v.Timeout == 0 {
+			v.Timeout = Duration(10 * time.Second)
+		}
+	}
 
 	// Validate all the items.
 	validate(
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditEntry is used to define a mutating API call that was recorded in the audit log. Keys are only
+// ever recorded as fingerprints.
+type AuditEntry struct {
+	ID             int64
+	Time           time.Time
+	Type           string
+	KeyFingerprint string
+	Partition      string
+	Path           string
+	TargetKey      string
+	ClientIP       string
+	Result         string
+	Status         int
+	Bytes          int64
+}
+
+// WriteAuditEntry is used to append an entry to the audit log.
+func (d *DB) WriteAuditEntry(ctx context.Context, e *AuditEntry) error {
+	const query = `
+		INSERT INTO audit_log (type, key_fingerprint, partition, path, target_key, client_ip, result, status, bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := d.conn.Exec(ctx, query, e.Type, e.KeyFingerprint, e.Partition, e.Path, e.TargetKey,
+		e.ClientIP, e.Result, e.Status, e.Bytes)
+	return err
+}
+
+// AuditFilter is used to filter the audit log. Blank fields are not filtered on, and Before is the ID
+// that the previous page ended at.
+type AuditFilter struct {
+	Type           string
+	KeyFingerprint string
+	Partition      string
+	PathPrefix     string
+	Result         string
+	Since          time.Time
+	Until          time.Time
+	Before         int64
+	Limit          int
+}
+
+// Escapes the characters that have a special meaning in a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// QueryAuditLog is used to get the audit log entries matching the filter, newest first.
+func (d *DB) QueryAuditLog(ctx context.Context, f *AuditFilter) ([]*AuditEntry, error) {
+	// Build the conditions.
+	conds := make([]string, 0)
+	args := make([]any, 0)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if f.Type != "" {
+		add("type = ?", f.Type)
+	}
+	if f.KeyFingerprint != "" {
+		add("(key_fingerprint = ? OR target_key = ?)", f.KeyFingerprint)
+	}
+	if f.Partition != "" {
+		add("partition = ?", f.Partition)
+	}
+	if f.PathPrefix != "" {
+		add("path LIKE ?", likeEscaper.Replace(f.PathPrefix)+"%")
+	}
+	if f.Result != "" {
+		add("result = ?", f.Result)
+	}
+	if !f.Since.IsZero() {
+		add("time >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("time < ?", f.Until)
+	}
+	if f.Before != 0 {
+		add("id < ?", f.Before)
+	}
+	query := "SELECT id, time, type, key_fingerprint, partition, path, target_key, client_ip, result, status, bytes FROM audit_log"
+	if len(conds) != 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	// Run the query.
+	rows, err := d.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]*AuditEntry, 0)
+	for rows.Next() {
+		var e AuditEntry
+		err = rows.Scan(&e.ID, &e.Time, &e.Type, &e.KeyFingerprint, &e.Partition, &e.Path, &e.TargetKey,
+			&e.ClientIP, &e.Result, &e.Status, &e.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, &e)
+	}
+	return s, rows.Err()
+}
@@ -2,18 +2,61 @@ package db
 
 import (
 	"context"
+	"errors"
 
+	"contenttruck/metrics"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// Defines what queries are run on, which is either the pool or a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	BeginFunc(ctx context.Context, f func(pgx.Tx) error) error
+}
+
 type DB struct {
-	conn *pgxpool.Pool
+	pool *pgxpool.Pool
+	conn querier
+}
+
+// Counts the errors that pgx logs. Cancelled contexts are not counted since the client went away.
+func countErrors(ctx context.Context, level pgx.LogLevel, msg string, data map[string]any) {
+	if err, ok := data["err"].(error); ok && errors.Is(err, context.Canceled) {
+		return
+	}
+	metrics.PostgresErrors.WithLabelValues(msg).Inc()
 }
 
 func NewDB(connString string) *DB {
-	conn, err := pgxpool.Connect(context.Background(), connString)
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		panic(err)
+	}
+	config.ConnConfig.Logger = pgx.LoggerFunc(countErrors)
+	config.ConnConfig.LogLevel = pgx.LogLevelError
+	conn, err := pgxpool.ConnectConfig(context.Background(), config)
 	if err != nil {
 		panic(err)
 	}
-	return &DB{conn: conn}
+	metrics.RegisterPool(conn.Stat)
+	return &DB{pool: conn, conn: conn}
+}
+
+// Close is used to close all of the connections in the pool. This waits for connections that are in use
+// to be released.
+func (d *DB) Close() {
+	d.pool.Close()
+}
+
+// Tx is used to run the function in a transaction. Everything done with the DB passed to the function is
+// committed together if it returns nil, and rolled back otherwise. Transactions can be nested.
+func (d *DB) Tx(ctx context.Context, fn func(tx *DB) error) error {
+	return d.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		return fn(&DB{pool: d.pool, conn: tx})
+	})
 }
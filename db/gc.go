@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// FileRecord is used to define a file that is recorded in a partition.
+type FileRecord struct {
+	Path            string
+	Partition       string
+	PartitionExists bool
+	CreatedAt       time.Time
+}
+
+// Gets the files after a path and partition in byte order, which is the order S3 lists objects in.
+const listFilesAfterQuery = `
+	SELECT f.file_path, f.name, p.name IS NOT NULL, f.created_at FROM partitions_files f
+		LEFT JOIN partitions p ON p.name = f.name
+		WHERE f.file_path COLLATE "C" > $1 OR (f.file_path = $1 AND f.name > $2)
+		ORDER BY f.file_path COLLATE "C", f.name LIMIT $3
+`
+
+// ListFilesAfter is used to get up to limit files after the path and partition, ordered by path in byte
+// order and then by partition. Start with blank strings to get the first page.
+func (d *DB) ListFilesAfter(ctx context.Context, path, partition string, limit int) ([]*FileRecord, error) {
+	rows, err := d.conn.Query(ctx, listFilesAfterQuery, path, partition, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]*FileRecord, 0, limit)
+	for rows.Next() {
+		var v FileRecord
+		if err = rows.Scan(&v.Path, &v.Partition, &v.PartitionExists, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		s = append(s, &v)
+	}
+	return s, rows.Err()
+}
+
+// FileRecords is used to get the records for a path in every partition.
+func (d *DB) FileRecords(ctx context.Context, path string) ([]*FileRecord, error) {
+	const query = `SELECT f.file_path, f.name, p.name IS NOT NULL, f.created_at FROM partitions_files f
+		LEFT JOIN partitions p ON p.name = f.name WHERE f.file_path COLLATE "C" = $1`
+	rows, err := d.conn.Query(ctx, query, path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]*FileRecord, 0)
+	for rows.Next() {
+		var v FileRecord
+		if err = rows.Scan(&v.Path, &v.Partition, &v.PartitionExists, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		s = append(s, &v)
+	}
+	return s, rows.Err()
+}
+
+// DeletePartitionFileBefore is used to forget a file in a partition if it was recorded before the time, so
+// records of uploads that are in progress are kept. The number of files in the usage of the partition goes
+// down with it, but the size is left since the size of the file is not recorded.
+func (d *DB) DeletePartitionFileBefore(ctx context.Context, name, path string, before time.Time) error {
+	return d.Tx(ctx, func(tx *DB) error {
+		const query = "DELETE FROM partitions_files WHERE name = $1 AND file_path = $2 AND created_at < $3"
+		tag, err := tx.conn.Exec(ctx, query, name, path, before)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		return tx.RollbackPartitionUsagePool(ctx, name, 0, 1)
+	})
+}
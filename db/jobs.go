@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Defines the types of jobs.
+const (
+	// JobDeletePartition is used to delete the files of a partition that was deleted.
+	JobDeletePartition = "delete_partition"
+)
+
+// Job is used to define work that is done in the background and survives restarts.
+type Job struct {
+	ID         int64
+	Type       string
+	Partition  string
+	Total      int64
+	Done       int64
+	LastError  string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// ErrJobNotExists is returned when a job does not exist.
+var ErrJobNotExists = errors.New("Job does not exist")
+
+// GetJob is used to get a job. Returns ErrJobNotExists if the job does not exist.
+func (d *DB) GetJob(ctx context.Context, id int64) (*Job, error) {
+	const query = `SELECT id, type, partition, total, done, last_error, created_at, finished_at FROM jobs
+		WHERE id = $1`
+	var j Job
+	err := d.conn.QueryRow(ctx, query, id).Scan(
+		&j.ID, &j.Type, &j.Partition, &j.Total, &j.Done, &j.LastError, &j.CreatedAt, &j.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrJobNotExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// Claims the oldest unfinished job that is not leased by pushing its lease back. If the process dies
+// whilst running it, the job will be claimed again once the lease is up.
+const claimJobQuery = `
+	UPDATE jobs SET lease_until = now() + $1 * INTERVAL '1 millisecond'
+	WHERE id = (
+		SELECT id FROM jobs WHERE finished_at IS NULL AND lease_until <= now()
+		ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+	) RETURNING id, type, partition, total, done, last_error, created_at
+`
+
+// ClaimJob claims a job that is due. Returns nil if there are no jobs to run.
+func (d *DB) ClaimJob(ctx context.Context, lease time.Duration) (*Job, error) {
+	var j Job
+	err := d.conn.QueryRow(ctx, claimJobQuery, lease.Milliseconds()).Scan(
+		&j.ID, &j.Type, &j.Partition, &j.Total, &j.Done, &j.LastError, &j.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// RecordJobProgress adds to the number of items a job has done and extends its lease.
+func (d *DB) RecordJobProgress(ctx context.Context, id, done int64, lease time.Duration) error {
+	const query = `UPDATE jobs SET done = done + $2, lease_until = now() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1`
+	_, err := d.conn.Exec(ctx, query, id, done, lease.Milliseconds())
+	return err
+}
+
+// RetryJob records why a job failed and releases it to be claimed again at the specified time.
+func (d *DB) RetryJob(ctx context.Context, id int64, next time.Time, lastError string) error {
+	const query = "UPDATE jobs SET lease_until = $2, last_error = $3 WHERE id = $1"
+	_, err := d.conn.Exec(ctx, query, id, next, lastError)
+	return err
+}
+
+// FinishJob marks a job as finished.
+func (d *DB) FinishJob(ctx context.Context, id int64) error {
+	const query = "UPDATE jobs SET finished_at = now(), last_error = '' WHERE id = $1"
+	_, err := d.conn.Exec(ctx, query, id)
+	return err
+}
+
+// ListPartitionFilesAfter is used to get up to limit paths recorded for a partition after the path.
+func (d *DB) ListPartitionFilesAfter(ctx context.Context, name, after string, limit int) ([]string, error) {
+	const query = `SELECT file_path FROM partitions_files WHERE name = $1 AND file_path > $2
+		ORDER BY file_path LIMIT $3`
+	rows, err := d.conn.Query(ctx, query, name, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]string, 0, limit)
+	for rows.Next() {
+		var path string
+		if err = rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		s = append(s, path)
+	}
+	return s, rows.Err()
+}
+
+// DeletePartitionFilePaths deletes files from a partition.
+func (d *DB) DeletePartitionFilePaths(ctx context.Context, name string, paths []string) error {
+	const query = "DELETE FROM partitions_files WHERE name = $1 AND file_path = ANY($2::TEXT[])"
+	_, err := d.conn.Exec(ctx, query, name, paths)
+	return err
+}
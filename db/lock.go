@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+)
+
+// Defines the advisory locks for jobs that should only run on one node at a time. They are taken in the
+// namespace of hashtext('contenttruck') so they do not collide with other users of the database.
+const (
+	// LockReconcile is held whilst partition usage is being reconciled.
+	LockReconcile int32 = 1
+
+	// LockGC is held whilst garbage is being collected.
+	LockGC int32 = 2
+
+	// LockTrash is held whilst expired files are being purged from the trash.
+	LockTrash int32 = 3
+)
+
+// TryLock is used to try to take a session advisory lock. If the lock is held elsewhere, ok is false.
+// Otherwise the unlock function must be called to release the lock and the connection holding it.
+func (d *DB) TryLock(ctx context.Context, id int32) (unlock func(), ok bool, err error) {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	const query = "SELECT pg_try_advisory_lock(hashtext('contenttruck'), $1)"
+	if err = conn.QueryRow(ctx, query, id).Scan(&ok); err != nil || !ok {
+		conn.Release()
+		return nil, false, err
+	}
+	return func() {
+		// If this fails, closing the connection releases the lock.
+		const query = "SELECT pg_advisory_unlock(hashtext('contenttruck'), $1)"
+		if _, err := conn.Exec(context.Background(), query, id); err != nil {
+			_ = conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}, true, nil
+}
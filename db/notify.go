@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Notify sends a notification with the payload to everything listening on the channel.
+func (d *DB) Notify(ctx context.Context, channel string, payload []byte) error {
+	_, err := d.conn.Exec(ctx, "SELECT pg_notify($1, $2)", channel, string(payload))
+	return err
+}
+
+// InsertStreamEvent inserts an event that is too large to send in a notification, and returns its ID.
+// Events that are over an hour old are deleted, since they have been streamed by then.
+func (d *DB) InsertStreamEvent(ctx context.Context, event []byte) (int64, error) {
+	const deleteQuery = "DELETE FROM stream_events WHERE created_at < now() - INTERVAL '1 hour'"
+	if _, err := d.conn.Exec(ctx, deleteQuery); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := d.conn.QueryRow(ctx, "INSERT INTO stream_events (event) VALUES ($1) RETURNING id", event).Scan(&id)
+	return id, err
+}
+
+// GetStreamEvent gets an event that was inserted with InsertStreamEvent.
+func (d *DB) GetStreamEvent(ctx context.Context, id int64) ([]byte, error) {
+	var event []byte
+	err := d.conn.QueryRow(ctx, "SELECT event FROM stream_events WHERE id = $1", id).Scan(&event)
+	return event, err
+}
+
+// Listen listens on a channel and calls the function with the payload of each notification. This holds a
+// connection from the pool until the context is cancelled or the connection fails.
+func (d *DB) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+	if err != nil {
+		return err
+	}
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// Don't put a connection that is still listening back in the pool.
+			_ = conn.Conn().Close(context.Background())
+			return err
+		}
+		fn(n.Payload)
+	}
+}
@@ -4,15 +4,33 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
+// ReservedPrefix is the prefix of paths that are reserved for contenttruck itself. Partitions cannot be
+// created under it.
+const ReservedPrefix = "_contenttruck/"
+
 // Partition is used to define information about a partition.
 type Partition struct {
-	Name       string
-	MaxSize    uint32
-	PathPrefix string
-	Exact      bool
-	Validates  string
+	Name         string
+	MaxSize      int64
+	PathPrefix   string
+	Exact        bool
+	Validates    string
+	ContentTypes string
+	Immutable    bool
+	MaxFileSize  int64
+	MinFileSize  int64
+	MaxFiles     int
+
+	// Trash is how long deleted files are kept for. If this is 0, files are deleted straight away.
+	Trash time.Duration
+
+	// Versions is how many previous versions of each file are kept. If this is 0, they are not kept.
+	Versions int
 }
 
 // Join is used to join a path to a partition.
@@ -33,8 +51,51 @@ func (p *Partition) Join(relPath string) string {
 	return p.PathPrefix
 }
 
+// FindPartition is used to get the partition that a path was most likely uploaded to when it is not
+// recorded. A partition whose path is the key is preferred, then the partition with the longest prefix, so
+// files in a nested partition are not counted in the partition around it. Returns nil for paths under the
+// reserved prefix or outside of every partition.
+func FindPartition(partitions []*Partition, key string) *Partition {
+	if strings.HasPrefix(key, ReservedPrefix) {
+		return nil
+	}
+	var match *Partition
+	matchLen := 0
+	for _, p := range partitions {
+		if p.PathPrefix == key {
+			// Nothing is longer than the path itself, so only an exact partition can replace this.
+			if matchLen <= len(key) || (p.Exact && !match.Exact) {
+				match = p
+				matchLen = len(key) + 1
+			}
+		} else if root := strings.TrimPrefix(p.PathPrefix, "/") + "/"; !p.Exact && len(root) > matchLen &&
+			strings.HasPrefix(key, root) {
+			match = p
+			matchLen = len(root)
+		}
+	}
+	return match
+}
+
+// AllowsContentType is used to check if a content type is allowed in the partition. The content types
+// are separated by pipes and can end with a wildcard subtype (for example, "image/*").
+func (p *Partition) AllowsContentType(contentType string) bool {
+	if p.ContentTypes == "" {
+		return true
+	}
+	contentType = strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	for _, v := range strings.Split(p.ContentTypes, "|") {
+		if v == contentType || (strings.HasSuffix(v, "/*") && strings.HasPrefix(contentType, v[:len(v)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
 const partitionByKey = `
-	SELECT partitions.name, partitions.max_size, partitions.path_prefix, partitions.exact, partitions.validates
+	SELECT partitions.name, partitions.max_size, partitions.path_prefix, partitions.exact, partitions.validates,
+		partitions.content_types, partitions.immutable, partitions.max_file_size, partitions.min_file_size,
+		partitions.max_files, partitions.trash, partitions.versions
 		FROM keys INNER JOIN partitions ON
 			partitions.name = keys.partition WHERE keys.key = $1
 `
@@ -50,7 +111,8 @@ func (d *DB) GetPartitionsByKey(ctx context.Context, key string) ([]*Partition,
 	s := make([]*Partition, 0)
 	for rows.Next() {
 		var p Partition
-		err = rows.Scan(&p.Name, &p.MaxSize, &p.PathPrefix, &p.Exact, &p.Validates)
+		err = rows.Scan(&p.Name, &p.MaxSize, &p.PathPrefix, &p.Exact, &p.Validates, &p.ContentTypes, &p.Immutable,
+			&p.MaxFileSize, &p.MinFileSize, &p.MaxFiles, &p.Trash, &p.Versions)
 		if err != nil {
 			return nil, err
 		}
@@ -63,98 +125,138 @@ func (d *DB) GetPartitionsByKey(ctx context.Context, key string) ([]*Partition,
 // If there is no files and the parition is smaller than the size of the file,
 // it will return a not-null constraint error. If there are files and adding this
 // file will make the partition too big, it will return no inserts or updates.
+// The same goes for the number of files if the partition limits it.
 const partitionSizeWriteQuery = `
-	INSERT INTO partitions_usage AS u (name, size) VALUES
-	((SELECT name FROM partitions WHERE name = $1 AND max_size >= $2), $2)
-	ON CONFLICT (name) DO UPDATE SET size = u.size + $2
+	INSERT INTO partitions_usage AS u (name, size, files) VALUES
+	((SELECT name FROM partitions WHERE name = $1 AND max_size >= $2 AND (max_files = 0 OR max_files >= $3)), $2, $3)
+	ON CONFLICT (name) DO UPDATE SET size = u.size + $2, files = u.files + $3
 	WHERE (SELECT max_size FROM partitions WHERE name = $1) >= u.size + $2
+	AND (SELECT max_files = 0 OR max_files >= u.files + $3 FROM partitions WHERE name = $1)
 `
 
 var ErrFileTooLarge = errors.New("Partition size is too small for specified file")
 
-// WriteToPartitionUsagePool writes to a partition's usage pool. Returns ErrFileTooLarge if the
-// mapped file is too large.
-func (d *DB) WriteToPartitionUsagePool(ctx context.Context, name string, size uint32) error {
-	tag, err := d.conn.Exec(ctx, partitionSizeWriteQuery, name, size)
+// ErrTooManyFiles is returned when a partition already has as many files as it allows.
+var ErrTooManyFiles = errors.New("Partition has too many files")
+
+// WriteToPartitionUsagePool writes to a partition's usage pool. files is the number of new files. Returns
+// ErrFileTooLarge if the mapped file is too large, or ErrTooManyFiles if there are too many files.
+func (d *DB) WriteToPartitionUsagePool(ctx context.Context, name string, size int64, files int) error {
+	tag, err := d.conn.Exec(ctx, partitionSizeWriteQuery, name, size, files)
 	if err != nil {
 		// Check if this is a not-null constraint error.
-		if strings.Contains(err.Error(), "violates not-null constraint") {
-			return ErrFileTooLarge
+		if !strings.Contains(err.Error(), "violates not-null constraint") {
+			return err
 		}
-		return err
+	} else if tag.RowsAffected() != 0 {
+		return nil
 	}
-	if tag.RowsAffected() == 0 {
-		return ErrFileTooLarge
+
+	// Work out which limit was hit.
+	const query = `SELECT p.max_files <> 0 AND COALESCE(u.files, 0) + $2 > p.max_files FROM partitions p
+		LEFT JOIN partitions_usage u ON u.name = p.name WHERE p.name = $1`
+	var tooMany bool
+	if err = d.conn.QueryRow(ctx, query, name, files).Scan(&tooMany); err == nil && tooMany {
+		return ErrTooManyFiles
 	}
-	return nil
+	return ErrFileTooLarge
 }
 
-// RollbackPartitionUsagePool updates a partition's usage pool with the data removed.
-func (d *DB) RollbackPartitionUsagePool(ctx context.Context, name string, size uint32) error {
-	const query = "UPDATE partitions_usage SET size = size - $1 WHERE name = $2 AND size >= $1"
-	_, err := d.conn.Exec(ctx, query, size, name)
+// RollbackPartitionUsagePool updates a partition's usage pool with the data and files removed.
+func (d *DB) RollbackPartitionUsagePool(ctx context.Context, name string, size int64, files int) error {
+	const query = `UPDATE partitions_usage SET size = GREATEST(size - $1, 0), files = GREATEST(files - $3, 0)
+		WHERE name = $2`
+	_, err := d.conn.Exec(ctx, query, size, name, files)
 	return err
 }
 
-// WritePartitionFile writes a file to a partition.
+// WritePartitionFile writes a file to a partition. If the file is already recorded because it is being
+// overwritten, this does nothing.
 func (d *DB) WritePartitionFile(ctx context.Context, name, path string) error {
-	const query = "INSERT INTO partitions_files (name, file_path) VALUES ($1, $2)"
+	const query = "INSERT INTO partitions_files (name, file_path) VALUES ($1, $2) ON CONFLICT DO NOTHING"
 	_, err := d.conn.Exec(ctx, query, name, path)
 	return err
 }
 
-// ErrPartitionExists is returned when a partition already exists.
-var ErrPartitionExists = errors.New("Partition already exists")
+// ErrFileExists is returned when a file is already recorded in a partition.
+var ErrFileExists = errors.New("File already exists")
 
-// InsertPartition inserts a partition. Returns ErrPartitionExists if the partition already exists.
-func (d *DB) InsertPartition(ctx context.Context, p *Partition) error {
-	const query = "INSERT INTO partitions (name, max_size, path_prefix, exact, validates) VALUES ($1, $2, $3, $4, $5)"
-	_, err := d.conn.Exec(ctx, query, p.Name, p.MaxSize, p.PathPrefix, p.Exact, p.Validates)
+// ClaimPartitionFile records a file in a partition before it is uploaded, so that only one upload can
+// create it. Returns ErrFileExists if the file is already recorded.
+func (d *DB) ClaimPartitionFile(ctx context.Context, name, path string) error {
+	const query = "INSERT INTO partitions_files (name, file_path) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	tag, err := d.conn.Exec(ctx, query, name, path)
 	if err != nil {
-		if strings.Contains(err.Error(), "violates unique constraint") {
-			return ErrPartitionExists
-		}
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrFileExists
+	}
 	return nil
 }
 
-// ErrPartitionNotExists is returned when a partition does not exist.
-var ErrPartitionNotExists = errors.New("Partition does not exist")
+// ErrPartitionExists is returned when a partition already exists.
+var ErrPartitionExists = errors.New("Partition already exists")
 
-// DeletePartition deletes a partition. Returns ErrPartitionNotExists if the partition does not exist.
-func (d *DB) DeletePartition(ctx context.Context, name string) error {
-	const query = "DELETE FROM partitions WHERE name = $1"
-	res, err := d.conn.Exec(ctx, query, name)
-	if err != nil {
-		return err
-	}
-	if res.RowsAffected() == 0 {
-		return ErrPartitionNotExists
-	}
-	return nil
-}
+// ErrPartitionDeleting is returned when a partition with the same name is still being deleted.
+var ErrPartitionDeleting = errors.New("Partition is still being deleted")
 
-// DeletePartitionFiles deletes all the files in a partition and calls the function for each file.
-func (d *DB) DeletePartitionFiles(ctx context.Context, name string, iter func(string) error) error {
-	const query = "SELECT file_path FROM partitions_files WHERE name = $1"
-	rows, err := d.conn.Query(ctx, query, name)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var path string
-		err = rows.Scan(&path)
+// Locks a partition name until the transaction ends, so it cannot be created whilst it is being deleted.
+const lockPartitionNameQuery = "SELECT pg_advisory_xact_lock(hashtext('contenttruck_partition'), hashtext($1))"
+
+// InsertPartition inserts a partition. Returns ErrPartitionExists if the partition already exists, or
+// ErrPartitionDeleting if its files are still being deleted.
+func (d *DB) InsertPartition(ctx context.Context, p *Partition) error {
+	return d.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, lockPartitionNameQuery, p.Name); err != nil {
+			return err
+		}
+		var deleting bool
+		const deletingQuery = "SELECT EXISTS (SELECT 1 FROM jobs WHERE partition = $1 AND finished_at IS NULL)"
+		if err := tx.QueryRow(ctx, deletingQuery, p.Name).Scan(&deleting); err != nil {
+			return err
+		}
+		if deleting {
+			return ErrPartitionDeleting
+		}
+
+		const query = `INSERT INTO partitions (name, max_size, path_prefix, exact, validates, content_types, immutable,
+			max_file_size, min_file_size, max_files, trash, versions)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+		_, err := tx.Exec(ctx, query, p.Name, p.MaxSize, p.PathPrefix, p.Exact, p.Validates, p.ContentTypes, p.Immutable,
+			p.MaxFileSize, p.MinFileSize, p.MaxFiles, p.Trash, p.Versions)
 		if err != nil {
+			if strings.Contains(err.Error(), "violates unique constraint") {
+				return ErrPartitionExists
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// ErrPartitionNotExists is returned when a partition does not exist.
+var ErrPartitionNotExists = errors.New("Partition does not exist")
+
+// DeletePartition deletes a partition and creates a job to delete its files. Returns the ID of the job,
+// or ErrPartitionNotExists if the partition does not exist.
+func (d *DB) DeletePartition(ctx context.Context, name string) (jobID int64, err error) {
+	err = d.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, lockPartitionNameQuery, name); err != nil {
 			return err
 		}
-		err = iter(path)
+		res, err := tx.Exec(ctx, "DELETE FROM partitions WHERE name = $1", name)
 		if err != nil {
 			return err
 		}
-	}
-	return nil
+		if res.RowsAffected() == 0 {
+			return ErrPartitionNotExists
+		}
+		const query = `INSERT INTO jobs (type, partition, total)
+			VALUES ($1, $2, (SELECT count(*) FROM partitions_files WHERE name = $2)) RETURNING id`
+		return tx.QueryRow(ctx, query, JobDeletePartition, name).Scan(&jobID)
+	})
+	return jobID, err
 }
 
 // DeletePartitionFile deletes a file from a partition.
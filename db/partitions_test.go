@@ -0,0 +1,41 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestFindPartition(t *testing.T) {
+	partitions := []*Partition{
+		{Name: "images", PathPrefix: "images"},
+		{Name: "avatars", PathPrefix: "images/avatars"},
+		{Name: "logo", PathPrefix: "images/logo.png", Exact: true},
+		{Name: "leading", PathPrefix: "/docs"},
+		{Name: "underscore", PathPrefix: "_"},
+	}
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"images/a.png", "images"},
+		{"images/avatars/a.png", "avatars"},
+		{"images/avatars", "avatars"},
+		{"images/logo.png", "logo"},
+		{"images/logo.png/a.png", "images"},
+		{"docs/a.pdf", "leading"},
+		{"_/a", "underscore"},
+		{"_contenttruck/trash/a", ""},
+		{"other/a.png", ""},
+		{"imagesx/a.png", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := ""
+			if p := FindPartition(partitions, tt.key); p != nil {
+				got = p.Name
+			}
+			if got != tt.want {
+				t.Errorf("FindPartition() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
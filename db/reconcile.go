@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ListPartitions is used to get all of the partitions.
+func (d *DB) ListPartitions(ctx context.Context) ([]*Partition, error) {
+	const query = `SELECT name, max_size, path_prefix, exact, validates, content_types, immutable, max_file_size,
+		min_file_size, max_files, trash, versions FROM partitions ORDER BY name`
+	rows, err := d.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]*Partition, 0)
+	for rows.Next() {
+		var p Partition
+		err = rows.Scan(&p.Name, &p.MaxSize, &p.PathPrefix, &p.Exact, &p.Validates, &p.ContentTypes, &p.Immutable,
+			&p.MaxFileSize, &p.MinFileSize, &p.MaxFiles, &p.Trash, &p.Versions)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, &p)
+	}
+	return s, rows.Err()
+}
+
+// GetPartitionUsage is used to get the recorded usage and number of files of a partition. These are 0 if
+// nothing has been uploaded to it.
+func (d *DB) GetPartitionUsage(ctx context.Context, name string) (size int64, files int, err error) {
+	const query = "SELECT size, files FROM partitions_usage WHERE name = $1"
+	err = d.conn.QueryRow(ctx, query, name).Scan(&size, &files)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, nil
+	}
+	return size, files, err
+}
+
+// ListPartitionFiles is used to get the paths of the files recorded for a partition.
+func (d *DB) ListPartitionFiles(ctx context.Context, name string) ([]string, error) {
+	const query = "SELECT file_path FROM partitions_files WHERE name = $1"
+	rows, err := d.conn.Query(ctx, query, name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]string, 0)
+	for rows.Next() {
+		var path string
+		if err = rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		s = append(s, path)
+	}
+	return s, rows.Err()
+}
+
+// FilesInOtherPartitions is used to get which of the paths are recorded for a partition other than name.
+func (d *DB) FilesInOtherPartitions(ctx context.Context, name string, paths []string) (map[string]bool, error) {
+	const query = `SELECT DISTINCT file_path FROM partitions_files WHERE file_path COLLATE "C" = ANY($1::TEXT[])
+		AND name <> $2`
+	rows, err := d.conn.Query(ctx, query, paths, name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	m := map[string]bool{}
+	for rows.Next() {
+		var path string
+		if err = rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		m[path] = true
+	}
+	return m, rows.Err()
+}
+
+// PartitionFix is used to define the corrected records for a partition.
+type PartitionFix struct {
+	Size    int64
+	Files   int
+	Missing []string
+	Stale   []string
+}
+
+// ErrPartitionUsageChanged is returned when the usage of a partition changed after it was checked, so the
+// fix may be out of date.
+var ErrPartitionUsageChanged = errors.New("Partition usage changed whilst it was being checked")
+
+// FixPartition is used to correct the records for a partition. size and files are the recorded usage and
+// number of files that the fix was worked out from. The usage row is only locked whilst the fix is applied,
+// and if it no longer matches them, nothing is changed and ErrPartitionUsageChanged is returned. Otherwise,
+// the usage and number of files are set to the ones of the fix, the missing files are recorded, and the stale
+// files are forgotten. Returns ErrPartitionNotExists if the partition has been deleted.
+func (d *DB) FixPartition(ctx context.Context, name string, size int64, files int, fix *PartitionFix) error {
+	return d.conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// Lock the partition so it cannot be deleted until this is committed.
+		var exists bool
+		err := tx.QueryRow(ctx, "SELECT true FROM partitions WHERE name = $1 FOR SHARE", name).Scan(&exists)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPartitionNotExists
+		}
+		if err != nil {
+			return err
+		}
+
+		// Lock the usage, creating it if nothing has been uploaded yet so there is a row to lock.
+		const insertQuery = "INSERT INTO partitions_usage (name, size, files) VALUES ($1, 0, 0) ON CONFLICT DO NOTHING"
+		if _, err = tx.Exec(ctx, insertQuery, name); err != nil {
+			return err
+		}
+		var lockedSize int64
+		var lockedFiles int
+		const lockQuery = "SELECT size, files FROM partitions_usage WHERE name = $1 FOR UPDATE"
+		if err = tx.QueryRow(ctx, lockQuery, name).Scan(&lockedSize, &lockedFiles); err != nil {
+			return err
+		}
+		if lockedSize != size || lockedFiles != files {
+			return ErrPartitionUsageChanged
+		}
+
+		if len(fix.Missing) != 0 {
+			const query = `INSERT INTO partitions_files (name, file_path) SELECT $1, unnest($2::TEXT[])
+				ON CONFLICT DO NOTHING`
+			if _, err = tx.Exec(ctx, query, name, fix.Missing); err != nil {
+				return err
+			}
+		}
+		if len(fix.Stale) != 0 {
+			const query = "DELETE FROM partitions_files WHERE name = $1 AND file_path = ANY($2::TEXT[])"
+			if _, err = tx.Exec(ctx, query, name, fix.Stale); err != nil {
+				return err
+			}
+		}
+		const query = "UPDATE partitions_usage SET size = $2, files = $3 WHERE name = $1"
+		_, err = tx.Exec(ctx, query, name, max(fix.Size, 0), max(fix.Files, 0))
+		return err
+	})
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// SchemaVersion is the version of schema.sql that this build needs.
+const SchemaVersion = 11
+
+// Ping is used to check the database can be reached.
+func (d *DB) Ping(ctx context.Context) error {
+	return d.pool.Ping(ctx)
+}
+
+// Defines the Postgres error code for a table that does not exist.
+const undefinedTableCode = "42P01"
+
+// GetSchemaVersion is used to get the version of schema.sql that was last applied. This is 0 if it was
+// last applied before versions were recorded.
+func (d *DB) GetSchemaVersion(ctx context.Context) (int, error) {
+	const query = "SELECT version FROM schema_version"
+	var version int
+	err := d.conn.QueryRow(ctx, query).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	// The table does not exist if schema.sql was last applied before versions were recorded.
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == undefinedTableCode {
+		return 0, nil
+	}
+	return version, err
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// TrashPrefix is the prefix that deleted files are kept under whilst they are in the trash.
+const TrashPrefix = ReservedPrefix + "trash/"
+
+// TrashItem is used to define a deleted file that is in the trash.
+type TrashItem struct {
+	ID        int64
+	Partition string
+	Path      string
+	Size      int64
+	DeletedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Key is used to get the key the file is stored at whilst it is in the trash.
+func (t *TrashItem) Key() string {
+	return TrashPrefix + strconv.FormatInt(t.ID, 10)
+}
+
+// ErrTrashNotExists is returned when an item is not in the trash.
+var ErrTrashNotExists = errors.New("File is not in the trash")
+
+// Scans the rows into trash items.
+func scanTrash(rows pgx.Rows, err error) ([]*TrashItem, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]*TrashItem, 0)
+	for rows.Next() {
+		var t TrashItem
+		if err = rows.Scan(&t.ID, &t.Partition, &t.Path, &t.Size, &t.DeletedAt, &t.ExpiresAt); err != nil {
+			return nil, err
+		}
+		s = append(s, &t)
+	}
+	return s, rows.Err()
+}
+
+// InsertTrash is used to add a file to the trash that expires after the retention. This should be done
+// before the file is copied to the key of the item.
+func (d *DB) InsertTrash(ctx context.Context, partition, path string, size int64, retention time.Duration) (*TrashItem, error) {
+	const query = `INSERT INTO trash (partition, file_path, size, expires_at)
+		VALUES ($1, $2, $3, now() + $4 * INTERVAL '1 millisecond')
+		RETURNING id, partition, file_path, size, deleted_at, expires_at`
+	var t TrashItem
+	err := d.conn.QueryRow(ctx, query, partition, path, size, retention.Milliseconds()).Scan(
+		&t.ID, &t.Partition, &t.Path, &t.Size, &t.DeletedAt, &t.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// PutTrash is used to put an item that was taken back in the trash.
+func (d *DB) PutTrash(ctx context.Context, t *TrashItem) error {
+	const query = `INSERT INTO trash (id, partition, file_path, size, deleted_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`
+	_, err := d.conn.Exec(ctx, query, t.ID, t.Partition, t.Path, t.Size, t.DeletedAt, t.ExpiresAt)
+	return err
+}
+
+// ListTrash is used to get up to limit items in the trash of a partition, newest first. If before is not
+// 0, only items with a lower ID are returned.
+func (d *DB) ListTrash(ctx context.Context, partition string, before int64, limit int) ([]*TrashItem, error) {
+	const query = `SELECT id, partition, file_path, size, deleted_at, expires_at FROM trash
+		WHERE partition = $1 AND ($2 = 0 OR id < $2) ORDER BY id DESC LIMIT $3`
+	return scanTrash(d.conn.Query(ctx, query, partition, before, limit))
+}
+
+// GetTrash is used to get the items with the IDs in the trash of a partition.
+func (d *DB) GetTrash(ctx context.Context, partition string, ids []int64) ([]*TrashItem, error) {
+	const query = `SELECT id, partition, file_path, size, deleted_at, expires_at FROM trash
+		WHERE partition = $1 AND id = ANY($2::BIGINT[]) ORDER BY id`
+	return scanTrash(d.conn.Query(ctx, query, partition, ids))
+}
+
+// ExpiredTrash is used to get up to limit items in the trash that have expired.
+func (d *DB) ExpiredTrash(ctx context.Context, limit int) ([]*TrashItem, error) {
+	const query = `SELECT id, partition, file_path, size, deleted_at, expires_at FROM trash
+		WHERE expires_at <= now() ORDER BY expires_at LIMIT $1`
+	return scanTrash(d.conn.Query(ctx, query, limit))
+}
+
+// TakeTrash is used to remove an item from the trash of a partition so it can be restored. Only one caller
+// can take an item. Returns ErrTrashNotExists if it is not in the trash.
+func (d *DB) TakeTrash(ctx context.Context, partition string, id int64) (*TrashItem, error) {
+	const query = `DELETE FROM trash WHERE partition = $1 AND id = $2
+		RETURNING id, partition, file_path, size, deleted_at, expires_at`
+	var t TrashItem
+	err := d.conn.QueryRow(ctx, query, partition, id).Scan(
+		&t.ID, &t.Partition, &t.Path, &t.Size, &t.DeletedAt, &t.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTrashNotExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteTrash is used to forget items in the trash.
+func (d *DB) DeleteTrash(ctx context.Context, ids []int64) error {
+	const query = "DELETE FROM trash WHERE id = ANY($1::BIGINT[])"
+	_, err := d.conn.Exec(ctx, query, ids)
+	return err
+}
+
+// TrashKeys is used to get the keys of every item in the trash.
+func (d *DB) TrashKeys(ctx context.Context) (map[string]bool, error) {
+	rows, err := d.conn.Query(ctx, "SELECT id FROM trash")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	m := map[string]bool{}
+	for rows.Next() {
+		t := TrashItem{}
+		if err = rows.Scan(&t.ID); err != nil {
+			return nil, err
+		}
+		m[t.Key()] = true
+	}
+	return m, rows.Err()
+}
+
+// TrashKeyExists is used to check if a key is used by an item in the trash.
+func (d *DB) TrashKeyExists(ctx context.Context, key string) (bool, error) {
+	s, ok := strings.CutPrefix(key, TrashPrefix)
+	if !ok {
+		return false, nil
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	var exists bool
+	err = d.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM trash WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
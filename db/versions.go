@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// VersionPrefix is the prefix that previous versions of files are kept under.
+const VersionPrefix = ReservedPrefix + "versions/"
+
+// Version is used to define a previous version of a file.
+type Version struct {
+	ID        int64
+	Partition string
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// Key is used to get the key the version is stored at.
+func (v *Version) Key() string {
+	return VersionPrefix + strconv.FormatInt(v.ID, 10)
+}
+
+// ErrVersionNotExists is returned when a version does not exist.
+var ErrVersionNotExists = errors.New("Version does not exist")
+
+// Scans the rows into versions.
+func scanVersions(rows pgx.Rows, err error) ([]*Version, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]*Version, 0)
+	for rows.Next() {
+		var v Version
+		if err = rows.Scan(&v.ID, &v.Partition, &v.Path, &v.Size, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		s = append(s, &v)
+	}
+	return s, rows.Err()
+}
+
+// Scans a row into a version. Returns ErrVersionNotExists if there is no row.
+func scanVersion(row pgx.Row) (*Version, error) {
+	var v Version
+	err := row.Scan(&v.ID, &v.Partition, &v.Path, &v.Size, &v.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVersionNotExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// InsertVersion is used to record a version of a file. This should be done before the file is copied to
+// the key of the version.
+func (d *DB) InsertVersion(ctx context.Context, partition, path string, size int64) (*Version, error) {
+	const query = `INSERT INTO versions (partition, file_path, size) VALUES ($1, $2, $3)
+		RETURNING id, partition, file_path, size, created_at`
+	return scanVersion(d.conn.QueryRow(ctx, query, partition, path, size))
+}
+
+// PutVersion is used to put a version that was taken back.
+func (d *DB) PutVersion(ctx context.Context, v *Version) error {
+	const query = `INSERT INTO versions (id, partition, file_path, size, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING`
+	_, err := d.conn.Exec(ctx, query, v.ID, v.Partition, v.Path, v.Size, v.CreatedAt)
+	return err
+}
+
+// ListVersions is used to get the versions of a file in a partition, newest first. If offset is not 0, that
+// many of the newest versions are skipped.
+func (d *DB) ListVersions(ctx context.Context, partition, path string, offset int) ([]*Version, error) {
+	const query = `SELECT id, partition, file_path, size, created_at FROM versions
+		WHERE partition = $1 AND file_path = $2 ORDER BY id DESC OFFSET $3`
+	return scanVersions(d.conn.Query(ctx, query, partition, path, offset))
+}
+
+// ListPartitionVersions is used to get up to limit versions of any file in a partition.
+func (d *DB) ListPartitionVersions(ctx context.Context, partition string, limit int) ([]*Version, error) {
+	const query = `SELECT id, partition, file_path, size, created_at FROM versions
+		WHERE partition = $1 ORDER BY id LIMIT $2`
+	return scanVersions(d.conn.Query(ctx, query, partition, limit))
+}
+
+// GetVersion is used to get a version of the file at the path. Returns ErrVersionNotExists if it does
+// not exist.
+func (d *DB) GetVersion(ctx context.Context, path string, id int64) (*Version, error) {
+	const query = `SELECT id, partition, file_path, size, created_at FROM versions
+		WHERE id = $1 AND file_path = $2`
+	return scanVersion(d.conn.QueryRow(ctx, query, id, path))
+}
+
+// TakeVersion is used to forget a version of a file in a partition so it can be restored. Only one caller
+// can take a version. Returns ErrVersionNotExists if it does not exist.
+func (d *DB) TakeVersion(ctx context.Context, partition, path string, id int64) (*Version, error) {
+	const query = `DELETE FROM versions WHERE partition = $1 AND file_path = $2 AND id = $3
+		RETURNING id, partition, file_path, size, created_at`
+	return scanVersion(d.conn.QueryRow(ctx, query, partition, path, id))
+}
+
+// DeleteVersions is used to forget versions.
+func (d *DB) DeleteVersions(ctx context.Context, ids []int64) error {
+	const query = "DELETE FROM versions WHERE id = ANY($1::BIGINT[])"
+	_, err := d.conn.Exec(ctx, query, ids)
+	return err
+}
+
+// GetPartitionVersionsSize is used to get the total size of the versions kept for a partition.
+func (d *DB) GetPartitionVersionsSize(ctx context.Context, partition string) (int64, error) {
+	const query = "SELECT COALESCE(SUM(size), 0)::BIGINT FROM versions WHERE partition = $1"
+	var size int64
+	err := d.conn.QueryRow(ctx, query, partition).Scan(&size)
+	return size, err
+}
+
+// VersionKeys is used to get the keys of every version.
+func (d *DB) VersionKeys(ctx context.Context) (map[string]bool, error) {
+	rows, err := d.conn.Query(ctx, "SELECT id FROM versions")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	m := map[string]bool{}
+	for rows.Next() {
+		v := Version{}
+		if err = rows.Scan(&v.ID); err != nil {
+			return nil, err
+		}
+		m[v.Key()] = true
+	}
+	return m, rows.Err()
+}
+
+// VersionKeyExists is used to check if a key is used by a version.
+func (d *DB) VersionKeyExists(ctx context.Context, key string) (bool, error) {
+	s, ok := strings.CutPrefix(key, VersionPrefix)
+	if !ok {
+		return false, nil
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	var exists bool
+	err = d.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM versions WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
+
+// FileState is used to define whether a file is recorded in a partition and whether it is in its trash.
+type FileState struct {
+	Recorded bool
+	Trashed  bool
+}
+
+// Live is used to check if the file is current, so its versions can be served.
+func (f FileState) Live() bool {
+	return f.Recorded && !f.Trashed
+}
+
+// VersionsNeeded is used to check if the versions of the file are still needed, which is until it is
+// deleted and purged from the trash.
+func (f FileState) VersionsNeeded() bool {
+	return f.Recorded || f.Trashed
+}
+
+// GetFileState is used to get whether a file is recorded in a partition and whether it is in its trash.
+func (d *DB) GetFileState(ctx context.Context, partition, path string) (FileState, error) {
+	const query = `SELECT EXISTS (SELECT 1 FROM partitions_files WHERE name = $1 AND file_path = $2),
+		EXISTS (SELECT 1 FROM trash WHERE partition = $1 AND file_path = $2)`
+	var f FileState
+	err := d.conn.QueryRow(ctx, query, partition, path).Scan(&f.Recorded, &f.Trashed)
+	return f, err
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestFileState(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      FileState
+		wantLive   bool
+		wantNeeded bool
+	}{
+		{"recorded", FileState{Recorded: true}, true, true},
+		{"trashed", FileState{Trashed: true}, false, true},
+		{"trashed and uploaded again", FileState{Recorded: true, Trashed: true}, false, true},
+		{"purged", FileState{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.Live(); got != tt.wantLive {
+				t.Errorf("Live() = %v, want %v", got, tt.wantLive)
+			}
+			if got := tt.state.VersionsNeeded(); got != tt.wantNeeded {
+				t.Errorf("VersionsNeeded() = %v, want %v", got, tt.wantNeeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// WebhookDelivery is used to define an event in the outbox that is waiting to be delivered to a webhook.
+type WebhookDelivery struct {
+	ID       int64
+	Webhook  string
+	Event    []byte
+	Attempts int
+}
+
+// EnqueueWebhookEvent inserts an event into the outbox for each of the webhooks.
+func (d *DB) EnqueueWebhookEvent(ctx context.Context, webhooks []string, event []byte) error {
+	const query = "INSERT INTO webhook_outbox (webhook, event) SELECT unnest($1::TEXT[]), $2"
+	_, err := d.conn.Exec(ctx, query, webhooks, event)
+	return err
+}
+
+// Claims deliveries that are due by pushing their next attempt back by the lease. If the process dies
+// whilst delivering, the delivery will be claimed again once the lease is up.
+const claimWebhookDeliveriesQuery = `
+	UPDATE webhook_outbox SET next_attempt_at = now() + $2 * INTERVAL '1 millisecond'
+	WHERE id IN (
+		SELECT id FROM webhook_outbox WHERE NOT failed AND next_attempt_at <= now()
+		ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+	) RETURNING id, webhook, event, attempts
+`
+
+// ClaimWebhookDeliveries claims up to limit deliveries that are due.
+func (d *DB) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	rows, err := d.conn.Query(ctx, claimWebhookDeliveriesQuery, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	s := make([]*WebhookDelivery, 0)
+	for rows.Next() {
+		var v WebhookDelivery
+		err = rows.Scan(&v.ID, &v.Webhook, &v.Event, &v.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, &v)
+	}
+	return s, rows.Err()
+}
+
+// DeleteWebhookDelivery deletes a delivery from the outbox once it has been delivered.
+func (d *DB) DeleteWebhookDelivery(ctx context.Context, id int64) error {
+	const query = "DELETE FROM webhook_outbox WHERE id = $1"
+	_, err := d.conn.Exec(ctx, query, id)
+	return err
+}
+
+// RetryWebhookDelivery records a failed attempt and schedules the next one. If failed is true, the
+// delivery will not be attempted again.
+func (d *DB) RetryWebhookDelivery(ctx context.Context, id int64, next time.Time, lastError string, failed bool) error {
+	const query = `UPDATE webhook_outbox SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3, failed = $4
+		WHERE id = $1`
+	_, err := d.conn.Exec(ctx, query, id, next, lastError, failed)
+	return err
+}
@@ -0,0 +1,142 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"contenttruck/config"
+	"contenttruck/db"
+	"github.com/google/uuid"
+)
+
+// Defines the event types.
+const (
+	// EventFileUploaded is used when a file is uploaded.
+	EventFileUploaded = "file.uploaded"
+
+	// EventFileDeleted is used when a file is deleted.
+	EventFileDeleted = "file.deleted"
+
+	// EventFileRestored is used when a file is restored from the trash.
+	EventFileRestored = "file.restored"
+
+	// EventPartitionCreated is used when a partition is created.
+	EventPartitionCreated = "partition.created"
+
+	// EventPartitionDeleted is used when a partition is deleted.
+	EventPartitionDeleted = "partition.deleted"
+
+	// EventKeyCreated is used when a key is created.
+	EventKeyCreated = "key.created"
+
+	// EventKeyDeleted is used when a key is deleted.
+	EventKeyDeleted = "key.deleted"
+
+	// EventQuotaExceeded is used when an upload is rejected because the partition is full.
+	EventQuotaExceeded = "quota.exceeded"
+)
+
+// Event is used to define an event that happened in contenttruck.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Partition   string    `json:"partition,omitempty"`
+	Partitions  []string  `json:"partitions,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+}
+
+// InPartition is used to check if the event relates to a partition.
+func (e *Event) InPartition(name string) bool {
+	if e.Partition == name {
+		return true
+	}
+	for _, v := range e.Partitions {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Publisher is used to publish events to the webhooks that are subscribed to them, and to the event
+// streams on every node.
+type Publisher struct {
+	DB       *db.DB
+	Webhooks []*config.Webhook
+}
+
+// Checks if a webhook is subscribed to an event.
+func subscribed(w *config.Webhook, e *Event) bool {
+	if len(w.Events) != 0 {
+		found := false
+		for _, v := range w.Events {
+			if v == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(w.Partitions) == 0 {
+		return true
+	}
+	for _, v := range w.Partitions {
+		if e.InPartition(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish is used to publish an event with the DB, which should be the transaction the change the event
+// describes is made in so that the event is only sent if the change is committed. The ID and time are set
+// if they are blank.
+func (p *Publisher) Publish(ctx context.Context, d *db.DB, e *Event) error {
+	if e.ID == "" {
+		e.ID = uuid.Must(uuid.NewRandom()).String()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	// Encode the event.
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// Send the event to the streams. Notifications in a transaction are sent when it commits. Postgres
+	// rejects large notifications, so large events are stored and only their ID is sent.
+	payload := b
+	if len(payload) > maxNotifyPayload {
+		id, err := d.InsertStreamEvent(ctx, b)
+		if err != nil {
+			return err
+		}
+		payload = []byte(`{"ref":` + strconv.FormatInt(id, 10) + `}`)
+	}
+	if err = d.Notify(ctx, NotifyChannel, payload); err != nil {
+		return err
+	}
+
+	// Find the webhooks subscribed to the event.
+	webhooks := make([]string, 0)
+	for _, w := range p.Webhooks {
+		if subscribed(w, e) {
+			webhooks = append(webhooks, w.Name)
+		}
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	// Write the event to the outbox.
+	return d.EnqueueWebhookEvent(ctx, webhooks, b)
+}
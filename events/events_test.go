@@ -0,0 +1,75 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"contenttruck/config"
+)
+
+func Test_subscribed(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook config.Webhook
+		event   Event
+		want    bool
+	}{
+		{"global", config.Webhook{}, Event{Type: EventFileUploaded, Partition: "a"}, true},
+		{"partition", config.Webhook{Partitions: []string{"a"}}, Event{Type: EventFileUploaded, Partition: "a"}, true},
+		{"other partition", config.Webhook{Partitions: []string{"b"}}, Event{Type: EventFileUploaded, Partition: "a"}, false},
+		{"key partitions", config.Webhook{Partitions: []string{"b"}}, Event{Type: EventKeyCreated, Partitions: []string{"a", "b"}}, true},
+		{"event type", config.Webhook{Events: []string{EventFileDeleted}}, Event{Type: EventFileDeleted}, true},
+		{"other event type", config.Webhook{Events: []string{EventFileDeleted}}, Event{Type: EventFileUploaded}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subscribed(&tt.webhook, &tt.event); got != tt.want {
+				t.Errorf("subscribed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_webhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{5, 160 * time.Second},
+		{100, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestBroker(t *testing.T) {
+	b := &Broker{}
+	fast, unsubscribeFast := b.Subscribe()
+	defer unsubscribeFast()
+	slow, unsubscribeSlow := b.Subscribe()
+	defer unsubscribeSlow()
+
+	// Fill the slow subscriber while draining the fast one.
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.broadcast(context.Background(), `{"id":"1","type":"file.uploaded","partition":"a"}`)
+		e := <-fast
+		if e.Type != EventFileUploaded || e.Partition != "a" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	}
+
+	// The slow subscriber should have been disconnected after its buffer filled.
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events, want %d", n, subscriberBuffer)
+	}
+}
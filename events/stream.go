@@ -0,0 +1,117 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"contenttruck/db"
+)
+
+// NotifyChannel is the Postgres channel that events are sent on so that every node can stream them.
+const NotifyChannel = "contenttruck_events"
+
+// Defines the settings for streaming events. Postgres rejects notifications of 8000 bytes or more, so events
+// larger than maxNotifyPayload are sent as a reference to the stream_events table.
+const (
+	subscriberBuffer = 64
+	listenRetryDelay = 5 * time.Second
+	maxNotifyPayload = 7000
+)
+
+// Defines a notification that refers to an event in the stream_events table.
+type notificationRef struct {
+	Ref int64 `json:"ref"`
+}
+
+// Broker is used to fan events that are sent on the Postgres channel out to the subscribers on this node.
+type Broker struct {
+	DB *db.DB
+
+	mu          sync.Mutex
+	subscribers map[chan *Event]struct{}
+}
+
+// Subscribe is used to subscribe to events. The channel is closed if the subscriber falls too far behind,
+// and the returned function must be called to unsubscribe.
+func (b *Broker) Subscribe() (<-chan *Event, func()) {
+	ch := make(chan *Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan *Event]struct{}{}
+	}
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Decodes the event in a notification payload, loading it if the payload is a reference to it.
+func (b *Broker) decode(ctx context.Context, payload string) (*Event, error) {
+	data := []byte(payload)
+	var ref notificationRef
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return nil, err
+	}
+	if ref.Ref != 0 {
+		var err error
+		if data, err = b.DB.GetStreamEvent(ctx, ref.Ref); err != nil {
+			return nil, err
+		}
+	}
+	var e Event
+	err := json.Unmarshal(data, &e)
+	return &e, err
+}
+
+// Sends a notification payload to all of the subscribers.
+func (b *Broker) broadcast(ctx context.Context, payload string) {
+	e, err := b.decode(ctx, payload)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Error decoding event notification", "err", err)
+		}
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// The subscriber is not keeping up. Disconnect it rather than silently dropping events,
+			// so the client knows to reconnect.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Run is used to listen for events until the context is cancelled, reconnecting if the connection fails.
+func (b *Broker) Run(ctx context.Context) {
+	for {
+		err := b.DB.Listen(ctx, NotifyChannel, func(payload string) {
+			b.broadcast(ctx, payload)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("Error listening for events", "err", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"contenttruck/config"
+	"contenttruck/db"
+)
+
+// Defines the settings for delivering webhooks.
+const (
+	webhookBatchSize   = 20
+	webhookLease       = time.Minute
+	webhookTimeout     = 15 * time.Second
+	webhookMaxAttempts = 15
+	webhookBaseBackoff = 10 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+// Gets how long to wait before the next attempt after the specified number of failed attempts.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return d
+}
+
+// Sends a delivery to the webhook.
+func send(ctx context.Context, client *http.Client, w *config.Webhook, d *db.WebhookDelivery) error {
+	// Sign the timestamp and the event in the same way as validation hooks.
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	_, _ = mac.Write([]byte(timestamp + "." + string(d.Event)))
+
+	// Make the request.
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(d.Event))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Contenttruck-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Contenttruck-Timestamp", timestamp)
+	req.Header.Set("X-Contenttruck-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Delivers an event from the outbox and records the result.
+func (p *Publisher) deliver(ctx context.Context, client *http.Client, webhooks map[string]*config.Webhook, d *db.WebhookDelivery) {
+	// The result is recorded even if the context is cancelled, since the lease will not have expired.
+	w := webhooks[d.Webhook]
+	if w == nil {
+		// The webhook was removed from the config.
+		if err := p.DB.DeleteWebhookDelivery(context.Background(), d.ID); err != nil {
+			slog.Error("Error deleting webhook delivery", "err", err, "delivery", d.ID)
+		}
+		return
+	}
+	err := send(ctx, client, w, d)
+	if err == nil {
+		err = p.DB.DeleteWebhookDelivery(context.Background(), d.ID)
+		if err != nil {
+			slog.Error("Error deleting webhook delivery", "err", err, "delivery", d.ID)
+		}
+		return
+	}
+
+	// Schedule the next attempt, or give up if there has been too many.
+	attempts := d.Attempts + 1
+	failed := attempts >= webhookMaxAttempts
+	if failed {
+		slog.Warn("Giving up delivering event to webhook", "err", err, "webhook", w.Name, "delivery", d.ID)
+	}
+	err = p.DB.RetryWebhookDelivery(
+		context.Background(), d.ID, time.Now().Add(webhookBackoff(attempts)), err.Error(), failed)
+	if err != nil {
+		slog.Error("Error scheduling webhook retry", "err", err, "delivery", d.ID)
+	}
+}
+
+// RunWebhooks is used to deliver events from the outbox to the webhooks until the context is cancelled.
+// This can run on every node since deliveries are claimed.
+func (p *Publisher) RunWebhooks(ctx context.Context) {
+	if len(p.Webhooks) == 0 {
+		return
+	}
+	webhooks := make(map[string]*config.Webhook, len(p.Webhooks))
+	for _, w := range p.Webhooks {
+		webhooks[w.Name] = w
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		// Claim and deliver a batch.
+		deliveries, err := p.DB.ClaimWebhookDeliveries(ctx, webhookBatchSize, webhookLease)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Error claiming webhook deliveries", "err", err)
+		}
+		wg := sync.WaitGroup{}
+		for _, d := range deliveries {
+			wg.Add(1)
+			go func(d *db.WebhookDelivery) {
+				defer wg.Done()
+				p.deliver(ctx, client, webhooks, d)
+			}(d)
+		}
+		wg.Wait()
+
+		// If the batch was full, there is probably more to deliver.
+		if len(deliveries) == webhookBatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
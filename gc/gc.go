@@ -0,0 +1,317 @@
+package gc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"contenttruck/db"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines the kinds of garbage.
+const (
+	// KindOrphanObject is used for objects that are not recorded and are outside of every partition, and
+	// for objects in the trash or versions that are not in their tables.
+	KindOrphanObject = "orphan_object"
+
+	// KindDanglingRecord is used for file records with no object in storage.
+	KindDanglingRecord = "dangling_record"
+
+	// KindDeletedPartition is used for objects that are only recorded in partitions that were deleted.
+	KindDeletedPartition = "deleted_partition"
+)
+
+// Defines how many file records are read at a time.
+const recordPageSize = 1000
+
+// Garbage is used to define an object or file record that can be removed.
+type Garbage struct {
+	Kind       string
+	Path       string
+	Size       int64
+	Partitions []string
+}
+
+// Collector is used to find and remove objects and file records that are no longer needed.
+type Collector struct {
+	DB     *db.DB
+	S3     *s3.S3
+	Bucket string
+
+	// MinAge is how old objects and file records have to be to be collected, since uploads can be stored
+	// before they are recorded, and recorded before they are stored.
+	MinAge time.Duration
+
+	// Rate is the maximum number of objects or records removed per second. If this is 0, there is no limit.
+	Rate float64
+}
+
+// Defines an object in storage.
+type object struct {
+	key      string
+	size     int64
+	modified time.Time
+}
+
+// Checks if an object that is not recorded is an orphan. Objects that could be in a partition are left for
+// reconciliation to record, and reserved objects are only orphans if they are in the trash or versions but
+// are not one of the kept keys.
+func isOrphan(key string, partitions []*db.Partition, kept map[string]bool) bool {
+	if strings.HasPrefix(key, db.TrashPrefix) || strings.HasPrefix(key, db.VersionPrefix) {
+		return !kept[key]
+	}
+	return !strings.HasPrefix(key, db.ReservedPrefix) && db.FindPartition(partitions, key) == nil
+}
+
+// Finds the garbage by walking the objects and file records together, since both are sorted by path in
+// byte order. Each function returns nil at the end. Objects modified after the cutoff are skipped.
+func merge(
+	nextObject func() (*object, error), nextRecords func() ([]*db.FileRecord, error),
+	partitions []*db.Partition, kept map[string]bool, cutoff time.Time, fn func(*Garbage) error,
+) error {
+	o, err := nextObject()
+	if err != nil {
+		return err
+	}
+	records, err := nextRecords()
+	if err != nil {
+		return err
+	}
+	for o != nil || records != nil {
+		var g *Garbage
+		switch {
+		case records == nil || (o != nil && o.key < records[0].Path):
+			if o.modified.Before(cutoff) && isOrphan(o.key, partitions, kept) {
+				g = &Garbage{Kind: KindOrphanObject, Path: o.key, Size: o.size}
+			}
+			if o, err = nextObject(); err != nil {
+				return err
+			}
+		case o == nil || records[0].Path < o.key:
+			// Files are recorded before they are uploaded, so new records may be for uploads in progress.
+			if recordsBefore(records, cutoff) {
+				g = &Garbage{Kind: KindDanglingRecord, Path: records[0].Path, Partitions: recordPartitions(records)}
+			}
+			if records, err = nextRecords(); err != nil {
+				return err
+			}
+		default:
+			if o.modified.Before(cutoff) && !anyPartitionExists(records) {
+				g = &Garbage{
+					Kind: KindDeletedPartition, Path: o.key, Size: o.size, Partitions: recordPartitions(records),
+				}
+			}
+			if o, err = nextObject(); err != nil {
+				return err
+			}
+			if records, err = nextRecords(); err != nil {
+				return err
+			}
+		}
+		if g != nil {
+			if err = fn(g); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Checks if an S3 error is because the object does not exist.
+func isNotFound(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "NoSuchKey" || awsErr.Code() == "NotFound"
+	}
+	return false
+}
+
+// Gets the names of the partitions the records are for.
+func recordPartitions(records []*db.FileRecord) []string {
+	s := make([]string, len(records))
+	for i, v := range records {
+		s[i] = v.Partition
+	}
+	return s
+}
+
+// Checks if all of the records were created before the time.
+func recordsBefore(records []*db.FileRecord, t time.Time) bool {
+	for _, v := range records {
+		if !v.CreatedAt.Before(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if any of the records are for a partition that exists.
+func anyPartitionExists(records []*db.FileRecord) bool {
+	for _, v := range records {
+		if v.PartitionExists {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets a function that returns each object in the bucket in order.
+func (c *Collector) objects(ctx context.Context) func() (*object, error) {
+	var (
+		page  []*s3.Object
+		token *string
+		done  bool
+	)
+	return func() (*object, error) {
+		for len(page) == 0 {
+			if done {
+				return nil, nil
+			}
+			out, err := c.S3.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+				Bucket:            aws.String(c.Bucket),
+				ContinuationToken: token,
+			})
+			if err != nil {
+				return nil, err
+			}
+			page = out.Contents
+			token = out.NextContinuationToken
+			done = !aws.BoolValue(out.IsTruncated)
+		}
+		o := page[0]
+		page = page[1:]
+		return &object{aws.StringValue(o.Key), aws.Int64Value(o.Size), aws.TimeValue(o.LastModified)}, nil
+	}
+}
+
+// Gets a function that returns the records for each path in order.
+func (c *Collector) records(ctx context.Context) func() ([]*db.FileRecord, error) {
+	var (
+		page          []*db.FileRecord
+		lastPath      string
+		lastPartition string
+		done          bool
+	)
+	return func() ([]*db.FileRecord, error) {
+		var group []*db.FileRecord
+		for {
+			if len(page) == 0 && !done {
+				var err error
+				page, err = c.DB.ListFilesAfter(ctx, lastPath, lastPartition, recordPageSize)
+				if err != nil {
+					return nil, err
+				}
+				done = len(page) < recordPageSize
+				if len(page) != 0 {
+					lastPath, lastPartition = page[len(page)-1].Path, page[len(page)-1].Partition
+				}
+			}
+			if len(page) == 0 || (group != nil && page[0].Path != group[0].Path) {
+				return group, nil
+			}
+			group = append(group, page[0])
+			page = page[1:]
+		}
+	}
+}
+
+// Checks that the garbage is still garbage and removes it. Records are only removed if they were created
+// before the cutoff. Returns false if it is no longer garbage.
+func (c *Collector) remove(ctx context.Context, g *Garbage, cutoff time.Time) (bool, error) {
+	switch g.Kind {
+	case KindDanglingRecord:
+		// Make sure the object was not uploaded since the records were read.
+		_, err := c.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(c.Bucket),
+			Key:    aws.String(g.Path),
+		})
+		if err == nil {
+			return false, nil
+		}
+		if !isNotFound(err) {
+			return false, err
+		}
+	default:
+		// Make sure the object was not recorded since the records were read.
+		records, err := c.DB.FileRecords(ctx, g.Path)
+		if err != nil {
+			return false, err
+		}
+		if (g.Kind == KindOrphanObject && len(records) != 0) || anyPartitionExists(records) {
+			return false, nil
+		}
+		if strings.HasPrefix(g.Path, db.TrashPrefix) || strings.HasPrefix(g.Path, db.VersionPrefix) {
+			exists := c.DB.TrashKeyExists
+			if strings.HasPrefix(g.Path, db.VersionPrefix) {
+				exists = c.DB.VersionKeyExists
+			}
+			if kept, err := exists(ctx, g.Path); err != nil || kept {
+				return false, err
+			}
+		}
+		_, err = c.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(c.Bucket),
+			Key:    aws.String(g.Path),
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	for _, v := range g.Partitions {
+		if err := c.DB.DeletePartitionFileBefore(ctx, v, g.Path, cutoff); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Run is used to find the garbage, and remove it if remove is true. The function is called for each piece
+// of garbage with whether it was removed and any error removing it.
+func (c *Collector) Run(ctx context.Context, remove bool, fn func(g *Garbage, removed bool, err error)) error {
+	partitions, err := c.DB.ListPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	kept, err := c.DB.TrashKeys(ctx)
+	if err != nil {
+		return err
+	}
+	versions, err := c.DB.VersionKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for k := range versions {
+		kept[k] = true
+	}
+
+	// Limit how quickly garbage is removed so the bucket and database are not overloaded.
+	var limiter <-chan time.Time
+	if remove && c.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / c.Rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	cutoff := time.Now().Add(-c.MinAge)
+	return merge(c.objects(ctx), c.records(ctx), partitions, kept, cutoff, func(g *Garbage) error {
+		if !remove {
+			fn(g, false, nil)
+			return nil
+		}
+		if limiter != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-limiter:
+			}
+		}
+		removed, err := c.remove(ctx, g, cutoff)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fn(g, removed, err)
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package gc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"contenttruck/db"
+)
+
+func Test_merge(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	cutoff := time.Now().Add(-24 * time.Hour)
+	objects := []*object{
+		{"_contenttruck/other", 8, old},
+		{"_contenttruck/trash/1", 9, old},
+		{"_contenttruck/trash/2", 10, old},
+		{"_contenttruck/versions/1", 11, old},
+		{"_contenttruck/versions/2", 12, old},
+		{"images/a.png", 1, old},
+		{"images/unrecorded.png", 2, old},
+		{"old/a.png", 3, old},
+		{"old/new.png", 4, time.Now()},
+		{"orphan.png", 5, old},
+		{"orphan/new.png", 6, time.Now()},
+		{"shared/a.png", 7, old},
+	}
+	records := [][]*db.FileRecord{
+		{{Path: "images/a.png", Partition: "images", PartitionExists: true}},
+		{{Path: "images/dangling.png", Partition: "images", PartitionExists: true}},
+		{{Path: "images/uploading.png", Partition: "images", PartitionExists: true, CreatedAt: time.Now()}},
+		{{Path: "old/a.png", Partition: "old"}},
+		{{Path: "old/b.png", Partition: "old"}},
+		{{Path: "old/new.png", Partition: "old"}},
+		{
+			{Path: "shared/a.png", Partition: "old"},
+			{Path: "shared/a.png", Partition: "shared", PartitionExists: true},
+		},
+	}
+	partitions := []*db.Partition{{Name: "images", PathPrefix: "images"}, {Name: "shared", PathPrefix: "shared"}}
+
+	nextObject := func() (*object, error) {
+		if len(objects) == 0 {
+			return nil, nil
+		}
+		o := objects[0]
+		objects = objects[1:]
+		return o, nil
+	}
+	nextRecords := func() ([]*db.FileRecord, error) {
+		if len(records) == 0 {
+			return nil, nil
+		}
+		r := records[0]
+		records = records[1:]
+		return r, nil
+	}
+	got := make([]Garbage, 0)
+	kept := map[string]bool{"_contenttruck/trash/1": true, "_contenttruck/versions/2": true}
+	err := merge(nextObject, nextRecords, partitions, kept, cutoff, func(g *Garbage) error {
+		got = append(got, *g)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Garbage{
+		{Kind: KindOrphanObject, Path: "_contenttruck/trash/2", Size: 10},
+		{Kind: KindOrphanObject, Path: "_contenttruck/versions/1", Size: 11},
+		{Kind: KindDanglingRecord, Path: "images/dangling.png", Partitions: []string{"images"}},
+		{Kind: KindDeletedPartition, Path: "old/a.png", Size: 3, Partitions: []string{"old"}},
+		{Kind: KindDanglingRecord, Path: "old/b.png", Partitions: []string{"old"}},
+		{Kind: KindOrphanObject, Path: "orphan.png", Size: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merge() = %+v, want %+v", got, want)
+	}
+}
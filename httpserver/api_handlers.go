@@ -2,21 +2,27 @@ package httpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"contenttruck/db"
+	"contenttruck/events"
+	"contenttruck/metrics"
+	"contenttruck/tracing"
 	"contenttruck/validations"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"contenttruck/validations/clamd"
+	"contenttruck/validations/validators"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ErrorCode is used to define the error code.
@@ -47,6 +53,15 @@ const (
 	// ErrorCodeTooLarge is used when the content is too large.
 	ErrorCodeTooLarge ErrorCode = "too_large"
 
+	// ErrorCodeFileTooLarge is used when the content is larger than the partition allows for one file.
+	ErrorCodeFileTooLarge ErrorCode = "file_too_large"
+
+	// ErrorCodeFileTooSmall is used when the content is smaller than the partition allows for one file.
+	ErrorCodeFileTooSmall ErrorCode = "file_too_small"
+
+	// ErrorCodeTooManyFiles is used when the partition already has as many files as it allows.
+	ErrorCodeTooManyFiles ErrorCode = "too_many_files"
+
 	// ErrorCodeValidationFailed is used when the validation failed.
 	ErrorCodeValidationFailed ErrorCode = "validation_failed"
 
@@ -58,24 +73,76 @@ const (
 
 	// ErrorCodePartitionExists is used when the partition already exists.
 	ErrorCodePartitionExists ErrorCode = "partition_exists"
+
+	// ErrorCodePartitionDeleting is used when a partition with the same name is still being deleted.
+	ErrorCodePartitionDeleting ErrorCode = "partition_deleting"
+
+	// ErrorCodeJobNotFound is used when a job does not exist.
+	ErrorCodeJobNotFound ErrorCode = "job_not_found"
+
+	// ErrorCodeContentTypeMismatch is used when the declared content type does not match the content.
+	ErrorCodeContentTypeMismatch ErrorCode = "content_type_mismatch"
+
+	// ErrorCodeContentTypeNotAllowed is used when the content type is not allowed in the partition.
+	ErrorCodeContentTypeNotAllowed ErrorCode = "content_type_not_allowed"
+
+	// ErrorCodeInfected is used when the malware scanner found the content is infected.
+	ErrorCodeInfected ErrorCode = "infected"
+
+	// ErrorCodeFileExists is used when a file already exists in a partition that does not allow overwrites.
+	ErrorCodeFileExists ErrorCode = "file_exists"
+
+	// ErrorCodeClientCertificateRequired is used when the API is called without a verified client certificate.
+	ErrorCodeClientCertificateRequired ErrorCode = "client_certificate_required"
+
+	// ErrorCodeTrashNotFound is used when a file is not in the trash.
+	ErrorCodeTrashNotFound ErrorCode = "trash_not_found"
+
+	// ErrorCodeVersionNotFound is used when a version of a file does not exist.
+	ErrorCodeVersionNotFound ErrorCode = "version_not_found"
+
+	// ErrorCodeScanFailed is used when the malware scanner could not scan the content.
+	ErrorCodeScanFailed ErrorCode = "scan_failed"
 )
 
 // APIError is used to define an API error.
 type APIError struct {
 	status int
 
-	Code    ErrorCode `json:"code"`
-	Message string    `json:"message"`
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"request_id,omitempty"`
 }
 
 type apiServer struct {
-	s *Server
+	s     *Server
+	audit *db.AuditEntry
+}
+
+// Gets the partition with the name if it is associated with the key.
+func (s *apiServer) keyPartition(ctx context.Context, key, name string) (*db.Partition, *APIError) {
+	partitions, err := s.getKeys(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range partitions {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, &APIError{
+		status:  http.StatusNotFound,
+		Code:    ErrorCodeInvalidPartition,
+		Message: "Partition not found or not associated with key",
+	}
 }
 
 func (s *apiServer) getKeys(ctx context.Context, key string) (partitions []*db.Partition, err *APIError) {
+	ctx, span := tracing.Start(ctx, "GetPartitionsByKey")
 	partitions, e1 := s.s.DB.GetPartitionsByKey(ctx, key)
+	tracing.End(span, e1)
 	if e1 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error getting partitions: %s\n", e1)
+		s.s.log(ctx).Error("Error getting partitions", "err", e1)
 		return nil, &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -106,8 +173,137 @@ type UploadResponse struct {
 	Size int64 `json:"size"`
 }
 
+// Defines content types that are treated as the same type.
+var contentTypeAliases = map[string]string{
+	"image/jpg":       "image/jpeg",
+	"image/pjpeg":     "image/jpeg",
+	"audio/mp3":       "audio/mpeg",
+	"audio/wave":      "audio/wav",
+	"audio/x-wav":     "audio/wav",
+	"audio/vnd.wave":  "audio/wav",
+	"application/ogg": "audio/ogg",
+}
+
+// Defines text content types that the sniffer cannot tell apart from plain text, but which are safe to
+// serve since browsers will not render them as a document.
+var safeTextContentTypes = map[string]bool{
+	"text/css":               true,
+	"text/csv":               true,
+	"text/markdown":          true,
+	"text/javascript":        true,
+	"application/javascript": true,
+	"application/json":       true,
+}
+
+// Resolves the content type that should be stored from the declared and sniffed content types. Returns
+// false if the declared content type does not match the content.
+func resolveContentType(declared, sniffed string) (string, bool) {
+	essence := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(strings.SplitN(s, ";", 2)[0]))
+		if alias, ok := contentTypeAliases[s]; ok {
+			return alias
+		}
+		return s
+	}
+	d := essence(declared)
+	switch {
+	case d == "" || d == "application/octet-stream" || d == essence(sniffed):
+		return sniffed, true
+	case essence(sniffed) == "text/plain" && safeTextContentTypes[d]:
+		return declared, true
+	default:
+		return "", false
+	}
+}
+
+// Gets the error for when a file already exists in a partition that does not allow overwrites.
+func fileExistsError() *APIError {
+	return &APIError{
+		status:  http.StatusConflict,
+		Code:    ErrorCodeFileExists,
+		Message: "File already exists and the partition does not allow overwrites",
+	}
+}
+
+// Gets the error for when writing to the usage pool of a partition was rejected because of one of its
+// limits. Returns nil if the error is not a limit.
+func quotaError(err error) *APIError {
+	switch {
+	case errors.Is(err, db.ErrTooManyFiles):
+		return &APIError{
+			status:  http.StatusConflict,
+			Code:    ErrorCodeTooManyFiles,
+			Message: "Partition has too many files",
+		}
+	case errors.Is(err, db.ErrFileTooLarge):
+		return &APIError{
+			status:  http.StatusRequestEntityTooLarge,
+			Code:    ErrorCodeTooLarge,
+			Message: "File is too large for partition",
+		}
+	default:
+		return nil
+	}
+}
+
+// Reserves space and the number of new files in the partition for an upload to the path.
+func (s *apiServer) reserve(r *http.Request, partition *db.Partition, p string, size int64, files int) *APIError {
+	ctx, span := tracing.Start(r.Context(), "WriteToPartitionUsagePool")
+	err := s.s.DB.WriteToPartitionUsagePool(ctx, partition.Name, size, files)
+	tracing.End(span, err)
+	if err != nil {
+		if apiErr := quotaError(err); apiErr != nil {
+			metrics.QuotaRejections.WithLabelValues(partition.Name).Inc()
+			e2 := s.s.publish(r.Context(), s.s.DB, &events.Event{
+				Type:      events.EventQuotaExceeded,
+				Partition: partition.Name,
+				Path:      p,
+				Size:      s.audit.Bytes,
+			})
+			if e2 != nil {
+				s.s.log(r.Context()).Error("Error publishing event", "err", e2)
+			}
+			return apiErr
+		}
+
+		s.s.log(r.Context()).Error("Error writing to partition usage pool", "err", err)
+		return &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	return nil
+}
+
+// Releases space and files in the partition. This is not cancelled if the client goes away.
+func (s *apiServer) release(r *http.Request, partition *db.Partition, size int64, files int) {
+	ctx, span := tracing.Start(context.WithoutCancel(r.Context()), "RollbackPartitionUsagePool")
+	err := s.s.DB.RollbackPartitionUsagePool(ctx, partition.Name, size, files)
+	tracing.End(span, err)
+	if err != nil {
+		s.s.log(r.Context()).Error("Error rolling back partition usage pool", "err", err)
+	}
+}
+
+// Deletes the versions of the file beyond how many the partition keeps, and releases their space. Failures
+// are only logged since the upload has already happened.
+func (s *apiServer) pruneVersions(r *http.Request, partition *db.Partition, p string) {
+	ctx, span := tracing.Start(context.WithoutCancel(r.Context()), "versions.Prune")
+	freed, err := s.s.Versions.Prune(ctx, partition, p)
+	tracing.End(span, err)
+	if err != nil {
+		s.s.log(r.Context()).Error("Error pruning versions", "err", err)
+	}
+	if freed != 0 {
+		s.release(r, partition, freed, 0)
+	}
+}
+
 // Upload is used to upload a file.
 func (s *apiServer) Upload(r *http.Request, req *UploadRequest) (*UploadResponse, *APIError) {
+	s.audit.Partition = req.Partition
+
 	// Get the partitions.
 	partitions, err := s.getKeys(r.Context(), req.Key)
 	if err != nil {
@@ -134,6 +330,7 @@ func (s *apiServer) Upload(r *http.Request, req *UploadRequest) (*UploadResponse
 
 	// Create the path based on the partition information.
 	p := partition.Join(req.RelativePath)
+	s.audit.Path = p
 
 	// Check Content-Length is present.
 	if r.ContentLength == -1 {
@@ -143,44 +340,143 @@ func (s *apiServer) Upload(r *http.Request, req *UploadRequest) (*UploadResponse
 			Message: "Content-Length header is required",
 		}
 	}
+	s.audit.Bytes = r.ContentLength
 
-	// Pre-allocate that amount of space from the partition.
-	e2 := s.s.DB.WriteToPartitionUsagePool(
-		r.Context(), partition.Name, uint32(r.ContentLength))
-	if e2 != nil {
-		if e2 == db.ErrFileTooLarge {
-			return nil, &APIError{
-				status:  http.StatusRequestEntityTooLarge,
-				Code:    ErrorCodeTooLarge,
-				Message: "File is too large for partition",
-			}
+	// Check the size of the file against the partition's limits before reading it.
+	if partition.MaxFileSize != 0 && r.ContentLength > partition.MaxFileSize {
+		return nil, &APIError{
+			status:  http.StatusRequestEntityTooLarge,
+			Code:    ErrorCodeFileTooLarge,
+			Message: "File is larger than the partition allows",
 		}
+	}
+	if r.ContentLength < partition.MinFileSize {
+		return nil, &APIError{
+			status:  http.StatusBadRequest,
+			Code:    ErrorCodeFileTooSmall,
+			Message: "File is smaller than the partition allows",
+		}
+	}
 
-		_, _ = fmt.Fprintf(os.Stderr, "Error writing to partition usage pool: %s\n", e2)
+	// Check if a file is being overwritten. If it was uploaded to this partition, it does not count as a new
+	// file, and only the difference in size is charged unless the old file is kept as a version.
+	var oldSize int64
+	newFiles := 1
+	st, e2 := s.s.S3.HeadObjectWithContext(r.Context(), &s3.HeadObjectInput{
+		Bucket: &s.s.Config.BucketName,
+		Key:    &p,
+	})
+	if e2 == nil {
+		if partition.Immutable {
+			return nil, fileExistsError()
+		}
+		if owner := objectPartition(st.Metadata); owner == "" || owner == partition.Name {
+			oldSize = *st.ContentLength
+			newFiles = 0
+		}
+	} else if !isNotFound(e2) {
+		s.s.log(r.Context()).Error("Error stating in S3", "err", e2)
 		return nil, &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
 			Message: "Internal Server Error",
 		}
 	}
+
+	// Record the file first if it cannot be overwritten, so that only one upload can create it.
 	rollback := true
-	defer func() {
-		if rollback {
-			err := s.s.DB.RollbackPartitionUsagePool(context.Background(), partition.Name, uint32(r.ContentLength))
-			if err != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "Error rolling back partition usage pool: %s\n", err)
+	if partition.Immutable {
+		ctx, span := tracing.Start(r.Context(), "ClaimPartitionFile")
+		e2 = s.s.DB.ClaimPartitionFile(ctx, partition.Name, p)
+		tracing.End(span, e2)
+		if e2 != nil {
+			if e2 == db.ErrFileExists {
+				return nil, fileExistsError()
+			}
+			s.s.log(r.Context()).Error("Error claiming partition file", "err", e2)
+			return nil, &APIError{
+				status:  http.StatusInternalServerError,
+				Code:    ErrorCodeInternalServerError,
+				Message: "Internal Server Error",
 			}
 		}
-	}()
+		defer func() {
+			if rollback {
+				ctx, span := tracing.Start(context.WithoutCancel(r.Context()), "DeletePartitionFile")
+				err := s.s.DB.DeletePartitionFile(ctx, partition.Name, p)
+				tracing.End(span, err)
+				if err != nil {
+					s.s.log(r.Context()).Error("Error deleting partition file", "err", err)
+				}
+			}
+		}()
+	}
+
+	// Pre-allocate the extra space and the new file from the partition.
+	keepVersion := partition.Versions != 0 && newFiles == 0
+	delta := r.ContentLength - oldSize
+	if keepVersion {
+		delta = r.ContentLength
+	}
+	if delta > 0 || newFiles != 0 {
+		reserved := max(delta, 0)
+		if err := s.reserve(r, partition, p, reserved, newFiles); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if rollback {
+				s.release(r, partition, reserved, newFiles)
+			}
+		}()
+	}
 
-	// Defines the reader. This is because if we need to consume for validation, it will be a different reader.
+	// Read the start of the body. The rest is streamed to S3, and is only spooled to disk if a validator
+	// needs to read past the header.
 	defer r.Body.Close()
-	var re io.Reader = io.LimitReader(r.Body, r.ContentLength)
+	content, e2 := validators.NewContent(io.LimitReader(r.Body, r.ContentLength), r.ContentLength)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error reading upload body", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	defer content.Close()
+
+	// Sniff the content type from the header. This is stored instead of the declared content type so a
+	// file cannot be served as something it is not.
+	contentType, ok := resolveContentType(r.Header.Get("Content-Type"), validators.DetectContentType(content.Header()))
+	if !ok {
+		return nil, &APIError{
+			status:  http.StatusBadRequest,
+			Code:    ErrorCodeContentTypeMismatch,
+			Message: "Content-Type header does not match the content",
+		}
+	}
+	if !partition.AllowsContentType(contentType) {
+		return nil, &APIError{
+			status:  http.StatusUnsupportedMediaType,
+			Code:    ErrorCodeContentTypeNotAllowed,
+			Message: "Content type is not allowed in partition",
+		}
+	}
+	content.Partition = partition.Name
+	content.Path = p
+	content.ContentType = contentType
+	content.Context = r.Context()
+	content.Logger = s.s.log(r.Context())
 
 	// Pass off to the validations engine if needed.
 	if partition.Validates != "" {
-		re, e2 = validations.Execute(re, partition.Validates)
+		_, span := tracing.Start(r.Context(), "Validate", attribute.String("contenttruck.validates", partition.Validates))
+		e2 = validations.Execute(content, partition.Validates)
+		tracing.End(span, e2)
 		if e2 != nil {
+			var verr *validations.Error
+			if errors.As(e2, &verr) {
+				metrics.ValidationFailures.WithLabelValues(verr.Validator).Inc()
+			}
 			return nil, &APIError{
 				status:  http.StatusBadRequest,
 				Code:    ErrorCodeValidationFailed,
@@ -189,24 +485,81 @@ func (s *apiServer) Upload(r *http.Request, req *UploadRequest) (*UploadResponse
 		}
 	}
 
+	// Scan the content for malware if a scanner is configured.
+	if s.s.Scanner != nil {
+		ctx, span := tracing.Start(r.Context(), "clamd.Scan")
+		e2 = s.s.Scanner.Scan(ctx, content.Open())
+		tracing.End(span, e2)
+
+		// If the body could not be read, the scan is of part of it, so this fails even if failing open.
+		if err := content.Err(); err != nil {
+			s.s.log(r.Context()).Error("Error reading upload body", "err", err)
+			return nil, &APIError{
+				status:  http.StatusInternalServerError,
+				Code:    ErrorCodeInternalServerError,
+				Message: "Internal Server Error",
+			}
+		}
+		if e2 != nil {
+			var infected *clamd.InfectedError
+			if errors.As(e2, &infected) {
+				return nil, &APIError{
+					status:  http.StatusBadRequest,
+					Code:    ErrorCodeInfected,
+					Message: infected.Error(),
+				}
+			}
+			s.s.log(r.Context()).Error("Error scanning upload", "err", e2)
+			if !s.s.Config.ClamdFailOpen {
+				return nil, &APIError{
+					status:  http.StatusServiceUnavailable,
+					Code:    ErrorCodeScanFailed,
+					Message: "Failed to scan the file",
+				}
+			}
+		}
+	}
+
+	// Keep the old file as a version before it is overwritten.
+	if keepVersion {
+		ctx, span := tracing.Start(r.Context(), "versions.Save")
+		version, e2 := s.s.Versions.Save(ctx, partition, p, oldSize)
+		tracing.End(span, e2)
+		if e2 != nil {
+			s.s.log(r.Context()).Error("Error saving version", "err", e2)
+			return nil, &APIError{
+				status:  http.StatusInternalServerError,
+				Code:    ErrorCodeInternalServerError,
+				Message: "Internal Server Error",
+			}
+		}
+		defer func() {
+			if rollback {
+				_, err := s.s.Versions.Delete(context.WithoutCancel(r.Context()), []*db.Version{version})
+				if err != nil {
+					s.s.log(r.Context()).Error("Error deleting version", "err", err)
+				}
+			}
+		}()
+	}
+
 	// Create a s3 upload manager.
 	uploader := s3manager.NewUploaderWithClient(s.s.S3)
 
 	// Upload the file to S3.
-	contentType := r.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
 	acl := "public-read"
-	_, e2 = uploader.Upload(&s3manager.UploadInput{
+	ctx, span := tracing.Start(r.Context(), "s3manager.Upload")
+	_, e2 = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket:      &s.s.Config.BucketName,
 		Key:         &p,
-		Body:        re,
+		Body:        content.Reader(),
 		ContentType: &contentType,
 		ACL:         &acl,
+		Metadata:    map[string]*string{partitionMetadataKey: &partition.Name},
 	})
+	tracing.End(span, e2)
 	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error uploading to S3: %s\n", e2)
+		s.s.log(r.Context()).Error("Error uploading to S3", "err", e2)
 		return nil, &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -214,10 +567,23 @@ func (s *apiServer) Upload(r *http.Request, req *UploadRequest) (*UploadResponse
 		}
 	}
 
-	// Write the file to the database.
-	e2 = s.s.DB.WritePartitionFile(r.Context(), partition.Name, p)
+	// Write the file to the database and publish the event together.
+	ctx, span = tracing.Start(r.Context(), "WritePartitionFile")
+	e2 = s.s.DB.Tx(ctx, func(tx *db.DB) error {
+		if err := tx.WritePartitionFile(ctx, partition.Name, p); err != nil {
+			return err
+		}
+		return s.s.publish(ctx, tx, &events.Event{
+			Type:        events.EventFileUploaded,
+			Partition:   partition.Name,
+			Path:        p,
+			Size:        r.ContentLength,
+			ContentType: contentType,
+		})
+	})
+	tracing.End(span, e2)
 	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error writing partition file: %s\n", e2)
+		s.s.log(r.Context()).Error("Error writing partition file", "err", e2)
 		return nil, &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -225,8 +591,17 @@ func (s *apiServer) Upload(r *http.Request, req *UploadRequest) (*UploadResponse
 		}
 	}
 
-	// Do not roll back the usage pool.
+	// Do not roll back, and release the space the old file used beyond the new one.
 	rollback = false
+	if delta < 0 {
+		s.release(r, partition, -delta, 0)
+	}
+
+	// Delete the versions the partition does not keep.
+	if keepVersion {
+		s.pruneVersions(r, partition, p)
+	}
+	metrics.UploadedBytes.WithLabelValues(partition.Name).Add(float64(r.ContentLength))
 
 	// Return the response.
 	return &UploadResponse{
@@ -243,6 +618,8 @@ type DeleteRequest struct {
 
 // Delete is used to delete a file.
 func (s *apiServer) Delete(r *http.Request, req *DeleteRequest) *APIError {
+	s.audit.Partition = req.Partition
+
 	// Get the partitions.
 	partitions, err := s.getKeys(r.Context(), req.Key)
 	if err != nil {
@@ -269,26 +646,25 @@ func (s *apiServer) Delete(r *http.Request, req *DeleteRequest) *APIError {
 
 	// Create the path based on the partition information.
 	p := partition.Join(req.RelativePath)
+	s.audit.Path = p
 
 	// Stat the file from S3.
-	st, e2 := s.s.S3.HeadObject(&s3.HeadObjectInput{
+	st, e2 := s.s.S3.HeadObjectWithContext(r.Context(), &s3.HeadObjectInput{
 		Bucket: &s.s.Config.BucketName,
 		Key:    &p,
 	})
 	if e2 != nil {
 		// If the file was not found, return a 404.
-		if awsErr, ok := e2.(awserr.Error); ok {
-			if awsErr.Code() == "NoSuchKey" {
-				return &APIError{
-					status:  http.StatusNotFound,
-					Code:    ErrorCodeInvalidPath,
-					Message: "File not found",
-				}
+		if isNotFound(e2) {
+			return &APIError{
+				status:  http.StatusNotFound,
+				Code:    ErrorCodeInvalidPath,
+				Message: "File not found",
 			}
 		}
 
 		// Otherwise, return a 500.
-		_, _ = fmt.Fprintf(os.Stderr, "Error stating in S3: %s\n", e2)
+		s.s.log(r.Context()).Error("Error stating in S3", "err", e2)
 		return &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -296,13 +672,37 @@ func (s *apiServer) Delete(r *http.Request, req *DeleteRequest) *APIError {
 		}
 	}
 
+	s.audit.Bytes = *st.ContentLength
+
+	// Copy the file to the trash first if the partition keeps deleted files.
+	var trashed *db.TrashItem
+	if partition.Trash != 0 {
+		ctx, span := tracing.Start(r.Context(), "trash.Move")
+		trashed, e2 = s.s.Trash.Move(ctx, partition, p, *st.ContentLength)
+		tracing.End(span, e2)
+		if e2 != nil {
+			s.s.log(r.Context()).Error("Error moving file to trash", "err", e2)
+			return &APIError{
+				status:  http.StatusInternalServerError,
+				Code:    ErrorCodeInternalServerError,
+				Message: "Internal Server Error",
+			}
+		}
+	}
+
 	// Delete the file from S3.
-	_, e2 = s.s.S3.DeleteObject(&s3.DeleteObjectInput{
+	_, e2 = s.s.S3.DeleteObjectWithContext(r.Context(), &s3.DeleteObjectInput{
 		Bucket: &s.s.Config.BucketName,
 		Key:    &p,
 	})
 	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error deleting from S3: %s\n", e2)
+		s.s.log(r.Context()).Error("Error deleting from S3", "err", e2)
+		if trashed != nil {
+			// The file is still there, so it should not be in the trash too.
+			if err := s.s.Trash.Purge(context.WithoutCancel(r.Context()), []*db.TrashItem{trashed}); err != nil {
+				s.s.log(r.Context()).Error("Error purging trash item", "err", err)
+			}
+		}
 		return &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -310,10 +710,25 @@ func (s *apiServer) Delete(r *http.Request, req *DeleteRequest) *APIError {
 		}
 	}
 
-	// Delete the file from the database.
-	e2 = s.s.DB.DeletePartitionFile(r.Context(), partition.Name, p)
+	// Delete the file from the database, reclaim it from the usage pool, and publish the event together.
+	ctx, span := tracing.Start(r.Context(), "DeletePartitionFile")
+	e2 = s.s.DB.Tx(ctx, func(tx *db.DB) error {
+		if err := tx.DeletePartitionFile(ctx, partition.Name, p); err != nil {
+			return err
+		}
+		if err := tx.RollbackPartitionUsagePool(ctx, partition.Name, *st.ContentLength, 1); err != nil {
+			return err
+		}
+		return s.s.publish(ctx, tx, &events.Event{
+			Type:      events.EventFileDeleted,
+			Partition: partition.Name,
+			Path:      p,
+			Size:      *st.ContentLength,
+		})
+	})
+	tracing.End(span, e2)
 	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error deleting partition file: %s\n", e2)
+		s.s.log(r.Context()).Error("Error deleting partition file", "err", e2)
 		return &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -321,14 +736,17 @@ func (s *apiServer) Delete(r *http.Request, req *DeleteRequest) *APIError {
 		}
 	}
 
-	// Reclaim from the usage pool.
-	e2 = s.s.DB.RollbackPartitionUsagePool(r.Context(), partition.Name, uint32(*st.ContentLength))
-	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error rolling back usage pool: %s\n", e2)
-		return &APIError{
-			status:  http.StatusInternalServerError,
-			Code:    ErrorCodeInternalServerError,
-			Message: "Internal Server Error",
+	// Delete the versions of the file too, since they count against the partition. If the file is in the
+	// trash, they are kept so it can be restored with them, and are deleted when it is purged.
+	if partition.Versions != 0 && trashed == nil {
+		ctx, span = tracing.Start(r.Context(), "versions.DeletePath")
+		freed, e2 := s.s.Versions.DeletePath(ctx, partition, p)
+		tracing.End(span, e2)
+		if e2 != nil {
+			s.s.log(r.Context()).Error("Error deleting versions", "err", e2)
+		}
+		if freed != 0 {
+			s.release(r, partition, freed, 0)
 		}
 	}
 
@@ -356,11 +774,14 @@ type CreateKeyRequest struct {
 
 // CreateKeyResponse is used to define the create key response.
 type CreateKeyResponse struct {
-	Key string `json:"key"`
+	Key            string `json:"key"`
+	KeyFingerprint string `json:"key_fingerprint"`
 }
 
 // CreateKey is used to create a new key.
 func (s *apiServer) CreateKey(r *http.Request, req *CreateKeyRequest) (*CreateKeyResponse, *APIError) {
+	s.audit.Partition = strings.Join(req.Partitions, ",")
+
 	// Validate the sudo key.
 	err := s.validateSudoKey(req.SudoKey)
 	if err != nil {
@@ -378,11 +799,20 @@ func (s *apiServer) CreateKey(r *http.Request, req *CreateKeyRequest) (*CreateKe
 
 	// Generate a random key.
 	key := uuid.Must(uuid.NewRandom()).String()
+	s.audit.TargetKey = keyFingerprint(key)
 
-	// Insert the key.
-	e2 := s.s.DB.InsertKey(r.Context(), key, req.Partitions)
+	// Insert the key and publish the event together.
+	e2 := s.s.DB.Tx(r.Context(), func(tx *db.DB) error {
+		if err := tx.InsertKey(r.Context(), key, req.Partitions); err != nil {
+			return err
+		}
+		return s.s.publish(r.Context(), tx, &events.Event{
+			Type:       events.EventKeyCreated,
+			Partitions: req.Partitions,
+		})
+	})
 	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error inserting key: %s\n", e2)
+		s.s.log(r.Context()).Error("Error inserting key", "err", e2)
 		return nil, &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -391,7 +821,7 @@ func (s *apiServer) CreateKey(r *http.Request, req *CreateKeyRequest) (*CreateKe
 	}
 
 	// Return the key.
-	return &CreateKeyResponse{Key: key}, nil
+	return &CreateKeyResponse{Key: key, KeyFingerprint: s.audit.TargetKey}, nil
 }
 
 // DeleteKeyRequest is used to define the delete key request.
@@ -402,16 +832,43 @@ type DeleteKeyRequest struct {
 
 // DeleteKey is used to delete a key.
 func (s *apiServer) DeleteKey(r *http.Request, req *DeleteKeyRequest) *APIError {
+	s.audit.TargetKey = keyFingerprint(req.Key)
+
 	// Validate the sudo key.
 	err := s.validateSudoKey(req.SudoKey)
 	if err != nil {
 		return err
 	}
 
-	// Delete the key.
-	e2 := s.s.DB.DeleteKey(r.Context(), req.Key)
+	// Get the partitions the key had so the event can be sent to the webhooks for them.
+	partitions, e2 := s.s.DB.GetPartitionsByKey(r.Context(), req.Key)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error getting partitions", "err", e2)
+		return &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+
+	partitionNames := make([]string, len(partitions))
+	for i, v := range partitions {
+		partitionNames[i] = v.Name
+	}
+	s.audit.Partition = strings.Join(partitionNames, ",")
+
+	// Delete the key and publish the event together.
+	e2 = s.s.DB.Tx(r.Context(), func(tx *db.DB) error {
+		if err := tx.DeleteKey(r.Context(), req.Key); err != nil {
+			return err
+		}
+		return s.s.publish(r.Context(), tx, &events.Event{
+			Type:       events.EventKeyDeleted,
+			Partitions: partitionNames,
+		})
+	})
 	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error deleting key: %s\n", e2)
+		s.s.log(r.Context()).Error("Error deleting key", "err", e2)
 		return &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -430,16 +887,20 @@ type CreatePartitionRequest struct {
 	RuleSet string `json:"rule_set"`
 }
 
-const halftb uint32 = 500 * 1024 * 1024
+const halftb int64 = 500 * 1024 * 1024
 
-// Parses a string of N b/kb/mb/gb/tb and returns the number of bytes.
-func parseSize(s string) (uint32, error) {
+// Parses a string of N b/kb/mb/gb/tb and returns the number of bytes. Returns an error if the number of
+// bytes does not fit in an int64.
+func parseSize(s string) (int64, error) {
 	s = strings.ToLower(strings.TrimSpace(s))
 	if len(s) == 0 {
 		return 0, fmt.Errorf("empty input")
 	}
+	if !strings.ContainsAny(s, "0123456789") {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
 	var (
-		size uint64
+		size int64
 		unit string
 	)
 	for i := len(s) - 1; i >= 0; i-- {
@@ -447,30 +908,52 @@ func parseSize(s string) (uint32, error) {
 		if c >= '0' && c <= '9' {
 			sizeStr := s[:i+1]
 			var err error
-			size, err = strconv.ParseUint(sizeStr, 10, 64)
-			if err != nil {
-				return 0, fmt.Errorf("invalid size: %v", err)
+			size, err = strconv.ParseInt(sizeStr, 10, 64)
+			if err != nil || size < 0 {
+				return 0, fmt.Errorf("invalid size: %q", sizeStr)
 			}
 			unit = s[i+1:]
 			break
 		}
 	}
+	var multiplier int64
 	switch strings.TrimSpace(unit) {
-	case "":
-		return uint32(size), nil
-	case "b":
-		return uint32(size), nil
+	case "", "b":
+		multiplier = 1
 	case "kb":
-		return uint32(size * 1024), nil
+		multiplier = 1024
 	case "mb":
-		return uint32(size * 1024 * 1024), nil
+		multiplier = 1024 * 1024
 	case "gb":
-		return uint32(size * 1024 * 1024 * 1024), nil
+		multiplier = 1024 * 1024 * 1024
 	case "tb":
-		return uint32(size * 1024 * 1024 * 1024 * 1024), nil
+		multiplier = 1024 * 1024 * 1024 * 1024
 	default:
 		return 0, fmt.Errorf("invalid size unit: %q", unit)
 	}
+	if size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size is too large: %q", s)
+	}
+	return size * multiplier, nil
+}
+
+// Parses a pipe separated list of content types for a partition.
+func parseContentTypes(s string) (string, error) {
+	parts := strings.Split(strings.ToLower(s), "|")
+	for i, v := range parts {
+		v = strings.TrimSpace(v)
+		typeSplit := strings.SplitN(v, "/", 2)
+		if len(typeSplit) != 2 || typeSplit[0] == "" || typeSplit[0] == "*" || typeSplit[1] == "" {
+			return "", fmt.Errorf("invalid content type: %q", v)
+		}
+		if typeSplit[1] != "*" {
+			if _, params, err := mime.ParseMediaType(v); err != nil || len(params) != 0 {
+				return "", fmt.Errorf("invalid content type: %q", v)
+			}
+		}
+		parts[i] = v
+	}
+	return strings.Join(parts, "|"), nil
 }
 
 func removeSlash(s string) string {
@@ -482,6 +965,8 @@ func removeSlash(s string) string {
 
 // CreatePartition is used to create a new partition.
 func (s *apiServer) CreatePartition(r *http.Request, req *CreatePartitionRequest) *APIError {
+	s.audit.Partition = req.Name
+
 	// Validate the sudo key.
 	err := s.validateSudoKey(req.SudoKey)
 	if err != nil {
@@ -534,14 +1019,78 @@ func (s *apiServer) CreatePartition(r *http.Request, req *CreatePartitionRequest
 			}
 			p.MaxSize = maxSize
 		case "ensure":
-			if !validations.Validate(equalsSplit[1]) {
+			if e2 := validations.Validate(equalsSplit[1]); e2 != nil {
 				return &APIError{
 					status:  http.StatusBadRequest,
 					Code:    ErrorCodeInvalidRuleSet,
-					Message: "Invalid rule set",
+					Message: "Invalid ensure rule: " + e2.Error(),
 				}
 			}
 			p.Validates = equalsSplit[1]
+		case "content-types":
+			contentTypes, e2 := parseContentTypes(equalsSplit[1])
+			if e2 != nil {
+				return &APIError{
+					status:  http.StatusBadRequest,
+					Code:    ErrorCodeInvalidRuleSet,
+					Message: "Invalid rule set",
+				}
+			}
+			p.ContentTypes = contentTypes
+		case "overwrite":
+			overwrite, e2 := strconv.ParseBool(equalsSplit[1])
+			if e2 != nil {
+				return &APIError{
+					status:  http.StatusBadRequest,
+					Code:    ErrorCodeInvalidRuleSet,
+					Message: "Invalid rule set",
+				}
+			}
+			p.Immutable = !overwrite
+		case "max-file-size", "min-file-size":
+			size, e2 := parseSize(equalsSplit[1])
+			if e2 != nil {
+				return &APIError{
+					status:  http.StatusBadRequest,
+					Code:    ErrorCodeInvalidRuleSet,
+					Message: "Invalid rule set",
+				}
+			}
+			if equalsSplit[0] == "max-file-size" {
+				p.MaxFileSize = size
+			} else {
+				p.MinFileSize = size
+			}
+		case "trash":
+			retention, e2 := time.ParseDuration(equalsSplit[1])
+			if e2 != nil || retention <= 0 {
+				return &APIError{
+					status:  http.StatusBadRequest,
+					Code:    ErrorCodeInvalidRuleSet,
+					Message: "Invalid rule set",
+				}
+			}
+			p.Trash = retention
+		case "versions":
+			versions, e2 := strconv.Atoi(equalsSplit[1])
+			if e2 != nil || versions <= 0 || versions > math.MaxInt32 {
+				return &APIError{
+					status:  http.StatusBadRequest,
+					Code:    ErrorCodeInvalidRuleSet,
+					Message: "Invalid rule set",
+				}
+			}
+			p.Versions = versions
+		case "max-files":
+			maxFiles, e2 := strconv.Atoi(equalsSplit[1])
+			if e2 != nil || maxFiles <= 0 || maxFiles > math.MaxInt32 {
+				return &APIError{
+					status:  http.StatusBadRequest,
+					Code:    ErrorCodeInvalidRuleSet,
+					Message: "Invalid rule set",
+				}
+			}
+			p.MaxFiles = maxFiles
 		default:
 			return &APIError{
 				status:  http.StatusBadRequest,
@@ -560,13 +1109,39 @@ func (s *apiServer) CreatePartition(r *http.Request, req *CreatePartitionRequest
 		}
 	}
 
+	// Make sure a file can be both large enough and small enough.
+	if p.MaxFileSize != 0 && p.MinFileSize > p.MaxFileSize {
+		return &APIError{
+			status:  http.StatusBadRequest,
+			Code:    ErrorCodeInvalidRuleSet,
+			Message: "min-file-size is larger than max-file-size",
+		}
+	}
+
+	// Make sure the partition is not under the reserved prefix.
+	if root := strings.TrimPrefix(p.PathPrefix, "/") + "/"; strings.HasPrefix(root, db.ReservedPrefix) {
+		return &APIError{
+			status:  http.StatusBadRequest,
+			Code:    ErrorCodeInvalidRuleSet,
+			Message: "Partition path is reserved",
+		}
+	}
+
 	// If max size is not set, set it to the default.
 	if p.MaxSize == 0 {
 		p.MaxSize = halftb
 	}
 
-	// Insert the partition.
-	e2 := s.s.DB.InsertPartition(r.Context(), &p)
+	// Insert the partition and publish the event together.
+	e2 := s.s.DB.Tx(r.Context(), func(tx *db.DB) error {
+		if err := tx.InsertPartition(r.Context(), &p); err != nil {
+			return err
+		}
+		return s.s.publish(r.Context(), tx, &events.Event{
+			Type:      events.EventPartitionCreated,
+			Partition: p.Name,
+		})
+	})
 	if e2 != nil {
 		if e2 == db.ErrPartitionExists {
 			return &APIError{
@@ -575,7 +1150,14 @@ func (s *apiServer) CreatePartition(r *http.Request, req *CreatePartitionRequest
 				Message: "Partition already exists",
 			}
 		}
-		_, _ = fmt.Fprintf(os.Stderr, "Error creating partition: %v\n", e2)
+		if e2 == db.ErrPartitionDeleting {
+			return &APIError{
+				status:  http.StatusConflict,
+				Code:    ErrorCodePartitionDeleting,
+				Message: "Partition is still being deleted",
+			}
+		}
+		s.s.log(r.Context()).Error("Error creating partition", "err", e2)
 		return &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
@@ -593,66 +1175,53 @@ type DeletePartitionRequest struct {
 	Name    string `json:"name"`
 }
 
+// DeletePartitionResponse is used to define the delete partition response. The files are deleted by the
+// job in the background.
+type DeletePartitionResponse struct {
+	JobID int64 `json:"job_id"`
+}
+
 // DeletePartition is used to delete a partition.
-func (s *apiServer) DeletePartition(r *http.Request, req *DeletePartitionRequest) *APIError {
+func (s *apiServer) DeletePartition(r *http.Request, req *DeletePartitionRequest) (*DeletePartitionResponse, *APIError) {
+	s.audit.Partition = req.Name
+
 	// Validate the sudo key.
 	err := s.validateSudoKey(req.SudoKey)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Delete the partition.
-	e2 := s.s.DB.DeletePartition(r.Context(), req.Name)
+	// Delete the partition, create the job to delete its files, and publish the event together.
+	ctx, span := tracing.Start(r.Context(), "DeletePartition")
+	var jobID int64
+	e2 := s.s.DB.Tx(ctx, func(tx *db.DB) error {
+		var err error
+		if jobID, err = tx.DeletePartition(ctx, req.Name); err != nil {
+			return err
+		}
+		return s.s.publish(ctx, tx, &events.Event{
+			Type:      events.EventPartitionDeleted,
+			Partition: req.Name,
+		})
+	})
+	tracing.End(span, e2)
 	if e2 != nil {
 		if e2 == db.ErrPartitionNotExists {
-			return &APIError{
+			return nil, &APIError{
 				status:  http.StatusBadRequest,
 				Code:    ErrorCodeInvalidPartition,
 				Message: "Partition does not exist",
 			}
 		}
-	}
-
-	// Defines the file handler.
-	wg := sync.WaitGroup{}
-	hn := func(path string) error {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			// Call the S3 delete method.
-			_, e2 := s.s.S3.DeleteObject(&s3.DeleteObjectInput{
-				Bucket: aws.String(s.s.Config.BucketName),
-				Key:    aws.String(path),
-			})
-			if e2 != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "Error deleting file: %s\n", e2)
-			}
-		}()
-		return nil
-	}
-
-	// Call delete partition files twice.
-	for i := 0; i < 2; i++ {
-		e2 = s.s.DB.DeletePartitionFiles(r.Context(), req.Name, hn)
-		if e2 != nil {
-			break
-		}
-	}
-
-	// Handle any errors.
-	if e2 != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error deleting partition files: %s\n", e2)
-		return &APIError{
+		s.s.log(r.Context()).Error("Error deleting partition", "err", e2)
+		return nil, &APIError{
 			status:  http.StatusInternalServerError,
 			Code:    ErrorCodeInternalServerError,
 			Message: "Internal Server Error",
 		}
 	}
+	s.s.Jobs.Wake()
 
-	// Wait for the file deletions to finish.
-	wg.Wait()
-
-	// Return success.
-	return nil
+	// Return the job.
+	return &DeletePartitionResponse{JobID: jobID}, nil
 }
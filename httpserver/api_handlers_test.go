@@ -0,0 +1,89 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"contenttruck/db"
+)
+
+func Test_parseSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{"bytes", "100", 100, false},
+		{"bytes unit", "100b", 100, false},
+		{"kilobytes", "2kb", 2 * 1024, false},
+		{"megabytes", " 5MB ", 5 * 1024 * 1024, false},
+		{"gigabytes", "10gb", 10 * 1024 * 1024 * 1024, false},
+		{"terabytes", "3tb", 3 * 1024 * 1024 * 1024 * 1024, false},
+		{"largest terabytes", "8388607tb", 8388607 * 1024 * 1024 * 1024 * 1024, false},
+		{"too many terabytes", "8388608tb", 0, true},
+		{"too many bytes", "9223372036854775808", 0, true},
+		{"negative", "-1gb", 0, true},
+		{"empty", "", 0, true},
+		{"no number", "gb", 0, true},
+		{"invalid unit", "10pb", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSize(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_quotaError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{"too many files", db.ErrTooManyFiles, http.StatusConflict, ErrorCodeTooManyFiles},
+		{"wrapped too many files", fmt.Errorf("writing usage: %w", db.ErrTooManyFiles), http.StatusConflict,
+			ErrorCodeTooManyFiles},
+		{"too large", db.ErrFileTooLarge, http.StatusRequestEntityTooLarge, ErrorCodeTooLarge},
+		{"other error", errors.New("connection reset"), 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := quotaError(tt.err)
+			if apiErr == nil {
+				if tt.wantStatus != 0 {
+					t.Fatalf("quotaError() = nil, want %s", tt.wantCode)
+				}
+				return
+			}
+			if tt.wantStatus == 0 {
+				t.Fatalf("quotaError() = %s, want nil", apiErr.Code)
+			}
+
+			// Check what the client gets back.
+			rec := httptest.NewRecorder()
+			writeAPIError(rec, httptest.NewRequest(http.MethodPost, "/", nil), apiErr)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var body APIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Code, tt.wantCode)
+			}
+		})
+	}
+}
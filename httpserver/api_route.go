@@ -2,16 +2,26 @@ package httpserver
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"reflect"
+	"runtime/debug"
 	"strconv"
 	"strings"
+
+	"contenttruck/db"
 )
 
-func handleApiRequest(r *http.Request, s *Server) (any, *APIError) {
+func handleApiRequest(r *http.Request, s *Server) (resp any, apiErr *APIError) {
+	// Require a verified client certificate if there is a client CA.
+	if s.Config.TLSClientCAFile != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return nil, &APIError{
+			status:  http.StatusUnauthorized,
+			Code:    ErrorCodeClientCertificateRequired,
+			Message: "A client certificate is required",
+		}
+	}
+
 	// Get the type.
 	type_ := r.Header.Get("X-Type")
 	if type_ == "" {
@@ -65,6 +75,30 @@ func handleApiRequest(r *http.Request, s *Server) (any, *APIError) {
 		}
 	}
 
+	// Record mutating calls in the audit log once the handler is done.
+	if a, ok := v.(auditedRequest); ok {
+		api.audit = &db.AuditEntry{
+			Type:           type_,
+			KeyFingerprint: keyFingerprint(a.auditKey()),
+			ClientIP:       clientIP(r, s.Config.TrustProxyHeaders),
+		}
+		defer func() {
+			if rec := recover(); rec != nil {
+				apiErr = &APIError{
+					status:  http.StatusInternalServerError,
+					Code:    ErrorCodeInternalServerError,
+					Message: "Internal Server Error",
+				}
+				s.writeAudit(r.Context(), api.audit, apiErr)
+				panic(rec)
+			}
+			s.writeAudit(r.Context(), api.audit, apiErr)
+		}()
+	} else {
+		// Handlers can always write to the entry, even if it is not recorded.
+		api.audit = &db.AuditEntry{}
+	}
+
 	// Call the handler.
 	ret := handler.Call([]reflect.Value{
 		reflect.ValueOf(r),
@@ -90,6 +124,11 @@ func (s *Server) api(w http.ResponseWriter, r *http.Request) {
 	// Render the JSON into the writer.
 	var encodeJson func(v any, status int)
 	encodeJson = func(v any, status int) {
+		// Include the request ID in errors so they can be reported.
+		if e, ok := v.(*APIError); ok {
+			e.RequestID = requestID(r.Context())
+		}
+
 		// Encode the JSON.
 		b, err := json.Marshal(v)
 		if err != nil {
@@ -99,7 +138,7 @@ func (s *Server) api(w http.ResponseWriter, r *http.Request) {
 				Code:    ErrorCodeInternalServerError,
 				Message: "Internal Server Error",
 			}, http.StatusInternalServerError)
-			_, _ = fmt.Fprintf(os.Stderr, "Error encoding JSON: %s\n", err.Error())
+			s.log(r.Context()).Error("Error encoding JSON", "err", err)
 			return
 		}
 
@@ -116,8 +155,8 @@ func (s *Server) api(w http.ResponseWriter, r *http.Request) {
 
 	// Handle recovers.
 	defer func() {
-		r := recover()
-		if r != nil {
+		rec := recover()
+		if rec != nil {
 			// Write the error.
 			encodeJson(&APIError{
 				status:  http.StatusInternalServerError,
@@ -126,7 +165,7 @@ func (s *Server) api(w http.ResponseWriter, r *http.Request) {
 			}, http.StatusInternalServerError)
 
 			// Log the error.
-			_, _ = fmt.Fprintf(os.Stderr, "Panic: %s\n", r)
+			s.log(r.Context()).Error("Panic", "panic", rec, "stack", string(debug.Stack()))
 		}
 	}()
 
@@ -0,0 +1,189 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"contenttruck/db"
+)
+
+// Defines a request that is recorded in the audit log. The key is the one used to make the request.
+type auditedRequest interface {
+	auditKey() string
+}
+
+func (r *UploadRequest) auditKey() string          { return r.Key }
+func (r *DeleteRequest) auditKey() string          { return r.Key }
+func (r *CreateKeyRequest) auditKey() string       { return r.SudoKey }
+func (r *DeleteKeyRequest) auditKey() string       { return r.SudoKey }
+func (r *CreatePartitionRequest) auditKey() string { return r.SudoKey }
+func (r *DeletePartitionRequest) auditKey() string { return r.SudoKey }
+
+// Gets the fingerprint of a key that is stored in the audit log instead of the key.
+func keyFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:8])
+}
+
+// Gets the IP address of the client. If proxy headers are trusted, this is the address that the last
+// proxy saw the request come from.
+func clientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if f := r.Header.Values("X-Forwarded-For"); len(f) != 0 {
+			s := strings.Split(f[len(f)-1], ",")
+			if ip := strings.TrimSpace(s[len(s)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Writes an entry to the audit log with the result of the request. This is done even if the request
+// context is cancelled, since the action may have already happened.
+func (s *Server) writeAudit(ctx context.Context, e *db.AuditEntry, err *APIError) {
+	e.Result = "ok"
+	e.Status = http.StatusOK
+	if err != nil {
+		e.Result = string(err.Code)
+		e.Status = err.status
+	}
+	if e2 := s.DB.WriteAuditEntry(context.Background(), e); e2 != nil {
+		s.log(ctx).Error("Error writing audit log", "err", e2, "type", e.Type)
+	}
+}
+
+// QueryAuditLogRequest is used to define the query audit log request. Since and Until are RFC 3339
+// timestamps, and Cursor is the NextCursor from the previous page.
+type QueryAuditLogRequest struct {
+	SudoKey        string `json:"sudo_key"`
+	Type           string `json:"type,omitempty"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	Partition      string `json:"partition,omitempty"`
+	PathPrefix     string `json:"path_prefix,omitempty"`
+	Result         string `json:"result,omitempty"`
+	Since          string `json:"since,omitempty"`
+	Until          string `json:"until,omitempty"`
+	Cursor         string `json:"cursor,omitempty"`
+	Limit          int    `json:"limit,omitempty"`
+}
+
+// AuditLogEntry is used to define an entry in the audit log.
+type AuditLogEntry struct {
+	ID             int64     `json:"id"`
+	Time           time.Time `json:"time"`
+	Type           string    `json:"type"`
+	KeyFingerprint string    `json:"key_fingerprint"`
+	Partition      string    `json:"partition,omitempty"`
+	Path           string    `json:"path,omitempty"`
+	TargetKey      string    `json:"target_key,omitempty"`
+	ClientIP       string    `json:"client_ip"`
+	Result         string    `json:"result"`
+	Status         int       `json:"status"`
+	Bytes          int64     `json:"bytes"`
+}
+
+// QueryAuditLogResponse is used to define the query audit log response. NextCursor is blank on the last page.
+type QueryAuditLogResponse struct {
+	Entries    []*AuditLogEntry `json:"entries"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// Defines the page sizes for the audit log.
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+// QueryAuditLog is used to query the audit log, newest first.
+func (s *apiServer) QueryAuditLog(r *http.Request, req *QueryAuditLogRequest) (*QueryAuditLogResponse, *APIError) {
+	// Validate the sudo key.
+	err := s.validateSudoKey(req.SudoKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the filter.
+	invalid := func(msg string) *APIError {
+		return &APIError{
+			status:  http.StatusBadRequest,
+			Code:    ErrorTypeInvalidJSON,
+			Message: msg,
+		}
+	}
+	f := &db.AuditFilter{
+		Type:           req.Type,
+		KeyFingerprint: req.KeyFingerprint,
+		Partition:      req.Partition,
+		PathPrefix:     req.PathPrefix,
+		Result:         req.Result,
+		Limit:          req.Limit,
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultAuditLogLimit
+	} else if f.Limit > maxAuditLogLimit {
+		f.Limit = maxAuditLogLimit
+	}
+	var e2 error
+	if req.Since != "" {
+		if f.Since, e2 = time.Parse(time.RFC3339, req.Since); e2 != nil {
+			return nil, invalid("Since must be a RFC 3339 timestamp")
+		}
+	}
+	if req.Until != "" {
+		if f.Until, e2 = time.Parse(time.RFC3339, req.Until); e2 != nil {
+			return nil, invalid("Until must be a RFC 3339 timestamp")
+		}
+	}
+	if req.Cursor != "" {
+		if f.Before, e2 = strconv.ParseInt(req.Cursor, 10, 64); e2 != nil || f.Before <= 0 {
+			return nil, invalid("Invalid cursor")
+		}
+	}
+
+	// Query the audit log.
+	entries, e2 := s.s.DB.QueryAuditLog(r.Context(), f)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error querying audit log", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+
+	// Build the response.
+	resp := &QueryAuditLogResponse{Entries: make([]*AuditLogEntry, len(entries))}
+	for i, e := range entries {
+		resp.Entries[i] = &AuditLogEntry{
+			ID:             e.ID,
+			Time:           e.Time,
+			Type:           e.Type,
+			KeyFingerprint: e.KeyFingerprint,
+			Partition:      e.Partition,
+			Path:           e.Path,
+			TargetKey:      e.TargetKey,
+			ClientIP:       e.ClientIP,
+			Result:         e.Result,
+			Status:         e.Status,
+			Bytes:          e.Bytes,
+		}
+	}
+	if len(entries) == f.Limit {
+		resp.NextCursor = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+	return resp, nil
+}
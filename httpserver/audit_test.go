@@ -0,0 +1,45 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_clientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		trust      bool
+		want       string
+	}{
+		{"remote address", "10.0.0.1:1234", nil, false, "10.0.0.1"},
+		{"ipv6 remote address", "[::1]:1234", nil, false, "::1"},
+		{"untrusted header", "10.0.0.1:1234", []string{"1.2.3.4"}, false, "10.0.0.1"},
+		{"trusted header", "10.0.0.1:1234", []string{"1.2.3.4"}, true, "1.2.3.4"},
+		{"trusted header chain", "10.0.0.1:1234", []string{"9.9.9.9, 1.2.3.4"}, true, "1.2.3.4"},
+		{"trusted multiple headers", "10.0.0.1:1234", []string{"9.9.9.9", "1.2.3.4"}, true, "1.2.3.4"},
+		{"trusted missing header", "10.0.0.1:1234", nil, true, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r, tt.trust); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_keyFingerprint(t *testing.T) {
+	if keyFingerprint("") != "" {
+		t.Error("blank keys should have a blank fingerprint")
+	}
+	a := keyFingerprint("a")
+	if len(a) != 16 || a == keyFingerprint("b") || a != keyFingerprint("a") {
+		t.Errorf("unexpected fingerprint %q", a)
+	}
+}
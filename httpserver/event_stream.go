@@ -0,0 +1,142 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"contenttruck/events"
+)
+
+// Defines how often a comment is sent to keep the event stream open. The key is also checked again at
+// this interval so that deleted keys stop receiving events.
+const eventStreamKeepAlive = 30 * time.Second
+
+// Writes an API error outside of the API route.
+func writeAPIError(w http.ResponseWriter, r *http.Request, err *APIError) {
+	err.RequestID = requestID(r.Context())
+	b, _ := json.Marshal(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(err.status)
+	_, _ = w.Write(b)
+}
+
+// Gets the function used to check if a key can see an event. Returns nil if the key is invalid.
+func (s *Server) eventFilter(r *http.Request, key string) (func(*events.Event) bool, error) {
+	if s.SudoKeyValidator(key) {
+		return func(*events.Event) bool { return true }, nil
+	}
+
+	partitions, err := s.DB.GetPartitionsByKey(r.Context(), key)
+	if err != nil || len(partitions) == 0 {
+		return nil, err
+	}
+	return func(e *events.Event) bool {
+		for _, p := range partitions {
+			if e.InPartition(p.Name) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// Streams the events that the key can see as Server-Sent Events. The key is passed in the query string
+// since EventSource cannot set headers.
+func (s *Server) eventStream(w http.ResponseWriter, r *http.Request) {
+	if s.Broker == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("Not Found"))
+		return
+	}
+
+	// Send clients to another node if this one is shutting down.
+	if s.shuttingDown.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Service Unavailable"))
+		return
+	}
+
+	// Check the key.
+	key := r.URL.Query().Get("key")
+	visible, err := s.eventFilter(r, key)
+	if err != nil {
+		s.log(r.Context()).Error("Error getting partitions", "err", err)
+		writeAPIError(w, r, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		})
+		return
+	}
+	if visible == nil {
+		writeAPIError(w, r, &APIError{
+			status:  http.StatusUnauthorized,
+			Code:    ErrorCodeInvalidKey,
+			Message: "Invalid key",
+		})
+		return
+	}
+
+	// Subscribe before writing the headers so no events are missed.
+	ch, unsubscribe := s.Broker.Subscribe()
+	defer unsubscribe()
+
+	// Write the headers. The stream is long lived, so it is not subject to the write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if rc.Flush() != nil {
+		return
+	}
+
+	ticker := time.NewTicker(eventStreamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done():
+			// The client will reconnect to another node.
+			return
+		case e, ok := <-ch:
+			if !ok {
+				// We fell behind. The client will reconnect.
+				return
+			}
+			if !visible(e) {
+				continue
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b)
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			// Make sure the key is still valid.
+			visible, err = s.eventFilter(r, key)
+			if err != nil || visible == nil {
+				return
+			}
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
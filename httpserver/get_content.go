@@ -1,16 +1,20 @@
 package httpserver
 
 import (
-	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"contenttruck/db"
+	"contenttruck/metrics"
+	"contenttruck/tracing"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/disintegration/imaging"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func parseInt(s string) uint64 {
@@ -21,6 +25,46 @@ func parseInt(s string) uint64 {
 	return i
 }
 
+// Defines the content security policy for SVG responses. Inline styles and data images are allowed
+// since they are commonly used in logos.
+const svgContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox"
+
+// Defines the S3 metadata key that the partition of a file is stored in.
+const partitionMetadataKey = "Partition"
+
+// Gets the partition a file was uploaded to from its metadata. This is blank for files uploaded before
+// the partition was stored.
+func objectPartition(metadata map[string]*string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, partitionMetadataKey) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
+
+// Checks if an S3 error is because the object does not exist. HEAD requests have no body, so they get a
+// different code.
+func isNotFound(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "NoSuchKey" || awsErr.Code() == "NotFound"
+	}
+	return false
+}
+
+// Defines a writer that counts the bytes written to it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write is used to write to the underlying writer and count the bytes.
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
 func default_[T any](x T, ptr *T) T {
 	if ptr == nil {
 		return x
@@ -36,7 +80,7 @@ func (s *Server) getContent(w http.ResponseWriter, r *http.Request) {
 			supportedMethods += ", POST"
 		}
 		w.Header().Set("Access-Control-Allow-Methods", supportedMethods)
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-Json-Body, X-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-Json-Body, X-Type, X-Request-Id")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Max-Age", "600")
 		w.Header().Set("Content-Length", "0")
@@ -48,17 +92,55 @@ func (s *Server) getContent(w http.ResponseWriter, r *http.Request) {
 	// Get the bucket key.
 	bucketKey := r.URL.Path[1:]
 
-	// Handle blank key.
-	if bucketKey == "" {
+	// Handle blank keys and keys under the reserved prefix.
+	if bucketKey == "" || strings.HasPrefix(bucketKey, db.ReservedPrefix) {
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = w.Write([]byte("Not Found"))
 		return
 	}
 
+	// Get a previous version of the file instead if one was requested.
+	objectKey := bucketKey
+	if v := r.URL.Query().Get("version"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("Not Found"))
+			return
+		}
+		version, err := s.DB.GetVersion(r.Context(), bucketKey, id)
+		if err != nil {
+			if err == db.ErrVersionNotExists {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("Not Found"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("Internal Server Error"))
+			s.log(r.Context()).Error("Error getting version", "err", err, "key", bucketKey)
+			return
+		}
+
+		// Versions of deleted files are kept whilst they are in the trash, but must not be served.
+		state, err := s.DB.GetFileState(r.Context(), version.Partition, bucketKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("Internal Server Error"))
+			s.log(r.Context()).Error("Error getting file state", "err", err, "key", bucketKey)
+			return
+		}
+		if !state.Live() {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("Not Found"))
+			return
+		}
+		objectKey = version.Key()
+	}
+
 	// Get from the bucket using the AWS SDK.
-	resp, err := s.S3.GetObject(&s3.GetObjectInput{
+	resp, err := s.S3.GetObjectWithContext(r.Context(), &s3.GetObjectInput{
 		Bucket: aws.String(s.Config.BucketName),
-		Key:    aws.String(bucketKey),
+		Key:    aws.String(objectKey),
 	})
 
 	// Check if it was not found. Explicitly check the error type.
@@ -72,12 +154,13 @@ func (s *Server) getContent(w http.ResponseWriter, r *http.Request) {
 		}
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte("Internal Server Error"))
-		_, _ = fmt.Fprintf(os.Stderr, "Error getting object %s from S3: %s\n", bucketKey, err.Error())
+		s.log(r.Context()).Error("Error getting object from S3", "err", err, "key", bucketKey)
 		return
 	}
 
 	// Ensure the body gets closed.
 	defer resp.Body.Close()
+	partition := objectPartition(resp.Metadata)
 
 	// Check if the w and/or h query parameters are set.
 	wParam := parseInt(r.URL.Query().Get("w"))
@@ -95,12 +178,16 @@ func (s *Server) getContent(w http.ResponseWriter, r *http.Request) {
 	// being efficient and preventing a DoS attack.
 	if wParam != 0 && hParam != 0 {
 		// Try and read the image.
+		start := time.Now()
+		_, span := tracing.Start(r.Context(), "Resize",
+			attribute.Int64("contenttruck.width", int64(wParam)), attribute.Int64("contenttruck.height", int64(hParam)))
 		img, err := imaging.Decode(io.LimitReader(resp.Body, 1024*1024*20))
 		if err != nil {
 			// Return a bad request.
+			tracing.End(span, err)
 			w.WriteHeader(http.StatusBadRequest)
 			_, _ = w.Write([]byte("Could not load as image"))
-			_, _ = fmt.Fprintf(os.Stderr, "Error decoding image %s: %s\n", bucketKey, err.Error())
+			s.log(r.Context()).Warn("Error decoding image", "err", err, "key", bucketKey)
 			return
 		}
 
@@ -111,12 +198,21 @@ func (s *Server) getContent(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/png")
 		w.Header().Set("Cache-Control", "max-age=3600")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		_ = imaging.Encode(w, img, imaging.PNG)
+		cw := &countingWriter{w: w}
+		err = imaging.Encode(cw, img, imaging.PNG)
+		tracing.End(span, err)
+		metrics.ResizeDuration.Observe(time.Since(start).Seconds())
+		metrics.ServedBytes.WithLabelValues(partition).Add(float64(cw.n))
 		return
 	}
 
-	// Set all the headers.
+	// Set all the headers. Browsers must not sniff the content since the content type was sniffed on upload.
 	w.Header().Set("Content-Type", default_("application/octet-stream", resp.ContentType))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if resp.ContentType != nil && strings.HasPrefix(*resp.ContentType, "image/svg+xml") {
+		// Stop any script in the SVG running or loading anything if it is opened directly.
+		w.Header().Set("Content-Security-Policy", svgContentSecurityPolicy)
+	}
 	w.Header().Set("Cache-Control", "max-age=3600")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	if resp.ContentLength != nil {
@@ -124,5 +220,6 @@ func (s *Server) getContent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Copy the body to the response.
-	_, _ = io.Copy(w, resp.Body)
+	n, _ := io.Copy(w, resp.Body)
+	metrics.ServedBytes.WithLabelValues(partition).Add(float64(n))
 }
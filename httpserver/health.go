@@ -0,0 +1,123 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"contenttruck/db"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines how long each readiness check can take.
+const readinessTimeout = 5 * time.Second
+
+// HealthCheck is used to define the result of a readiness check.
+type HealthCheck struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// HealthResponse is used to define the response of the health and readiness endpoints.
+type HealthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// MarkShuttingDown is used to make readiness fail so load balancers stop sending requests before the
+// server shuts down. This also closes the event streams, since they would stop the server shutting down.
+func (s *Server) MarkShuttingDown() {
+	if s.shuttingDown.CompareAndSwap(false, true) {
+		close(s.done())
+	}
+}
+
+// Writes a health response.
+func writeHealth(w http.ResponseWriter, resp *HealthResponse) {
+	b, _ := json.Marshal(resp)
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// Handles the liveness check, which passes as long as the process can serve requests.
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, &HealthResponse{Status: "ok"})
+}
+
+// Handles the readiness check, which checks the dependencies and that the server is not shutting down.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	s.ready(w, r, s.readinessChecks())
+}
+
+// Gets the checks of the dependencies the server needs to be ready.
+func (s *Server) readinessChecks() map[string]func(ctx context.Context) error {
+	return map[string]func(ctx context.Context) error{
+		"postgres": s.DB.Ping,
+		"bucket": func(ctx context.Context) error {
+			_, err := s.S3.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: &s.Config.BucketName})
+			return err
+		},
+		"schema": func(ctx context.Context) error {
+			version, err := s.DB.GetSchemaVersion(ctx)
+			if err != nil {
+				return err
+			}
+			if version < db.SchemaVersion {
+				return fmt.Errorf("schema version is %d but %d is needed, run schema.sql", version, db.SchemaVersion)
+			}
+			return nil
+		},
+	}
+}
+
+// Runs the readiness checks at the same time and writes the result.
+func (s *Server) ready(w http.ResponseWriter, r *http.Request, checks map[string]func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := &HealthResponse{Status: "ok", Checks: make(map[string]*HealthCheck, len(checks)+1)}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			result := &HealthCheck{Status: "ok", DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			resp.Checks[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	// Fail if the server is shutting down so that no new requests are sent here.
+	if s.shuttingDown.Load() {
+		resp.Checks["shutdown"] = &HealthCheck{Status: "fail", Error: "server is shutting down"}
+	}
+
+	for _, v := range resp.Checks {
+		if v.Status != "ok" {
+			resp.Status = "fail"
+			break
+		}
+	}
+	writeHealth(w, resp)
+}
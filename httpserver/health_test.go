@@ -0,0 +1,166 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Decodes the health response from a recorder.
+func decodeHealth(t *testing.T, rec *httptest.ResponseRecorder) *HealthResponse {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+	var resp HealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func TestServer_healthz(t *testing.T) {
+	tests := []struct {
+		name         string
+		shuttingDown bool
+	}{
+		{"running", false},
+		{"shutting down", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			if tt.shuttingDown {
+				s.MarkShuttingDown()
+			}
+			rec := httptest.NewRecorder()
+			s.healthz(rec, httptest.NewRequest(http.MethodGet, "/_contenttruck/healthz", nil))
+
+			// Liveness passes whilst shutting down so the process is not restarted.
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if resp := decodeHealth(t, rec); resp.Status != "ok" || resp.Checks != nil {
+				t.Errorf("response = %+v, want ok with no checks", resp)
+			}
+		})
+	}
+}
+
+func TestServer_readyz(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("unreachable") }
+	tests := []struct {
+		name         string
+		checks       map[string]func(ctx context.Context) error
+		shuttingDown bool
+		cancelled    bool
+		wantStatus   int
+		wantFailed   []string
+	}{
+		{
+			name:       "all ok",
+			checks:     map[string]func(ctx context.Context) error{"postgres": ok, "bucket": ok, "schema": ok},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "one fails",
+			checks:     map[string]func(ctx context.Context) error{"postgres": fail, "bucket": ok, "schema": ok},
+			wantStatus: http.StatusServiceUnavailable,
+			wantFailed: []string{"postgres"},
+		},
+		{
+			name:       "all fail",
+			checks:     map[string]func(ctx context.Context) error{"postgres": fail, "bucket": fail},
+			wantStatus: http.StatusServiceUnavailable,
+			wantFailed: []string{"postgres", "bucket"},
+		},
+		{
+			name:         "shutting down",
+			checks:       map[string]func(ctx context.Context) error{"postgres": ok},
+			shuttingDown: true,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantFailed:   []string{"shutdown"},
+		},
+		{
+			name: "check times out",
+			checks: map[string]func(ctx context.Context) error{"postgres": func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}},
+			cancelled:  true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantFailed: []string{"postgres"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			if tt.shuttingDown {
+				s.MarkShuttingDown()
+			}
+			r := httptest.NewRequest(http.MethodGet, "/_contenttruck/readyz", nil)
+			if tt.cancelled {
+				ctx, cancel := context.WithCancel(r.Context())
+				cancel()
+				r = r.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+			s.ready(rec, r, tt.checks)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			resp := decodeHealth(t, rec)
+			wantStatus := "ok"
+			if len(tt.wantFailed) != 0 {
+				wantStatus = "fail"
+			}
+			if resp.Status != wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, wantStatus)
+			}
+			failed := map[string]bool{}
+			for _, v := range tt.wantFailed {
+				failed[v] = true
+			}
+			for name := range tt.checks {
+				if _, ok := resp.Checks[name]; !ok {
+					t.Errorf("check %q is missing", name)
+				}
+			}
+			for name, check := range resp.Checks {
+				if (check.Status == "fail") != failed[name] {
+					t.Errorf("check %q status = %q, want failed %v", name, check.Status, failed[name])
+				}
+				if (check.Error != "") != failed[name] {
+					t.Errorf("check %q error = %q, want failed %v", name, check.Error, failed[name])
+				}
+			}
+		})
+	}
+}
+
+func TestServer_WaitInFlight(t *testing.T) {
+	s := &Server{}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_contenttruck/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status before stopping = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if err := s.WaitInFlight(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests that arrive on open connections once the server has stopped are rejected.
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_contenttruck/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status after stopping = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -1,11 +1,26 @@
 package httpserver
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"log/slog"
 	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"contenttruck/config"
 	"contenttruck/db"
+	"contenttruck/events"
+	"contenttruck/jobs"
+	"contenttruck/metrics"
+	"contenttruck/tracing"
+	"contenttruck/trash"
+	"contenttruck/validations/clamd"
+	"contenttruck/versions"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Server is used to define the HTTP server.
@@ -14,13 +29,169 @@ type Server struct {
 	DB               *db.DB
 	SudoKeyValidator func(string) bool
 	S3               *s3.S3
+	Scanner          *clamd.Client
+	Events           *events.Publisher
+	Broker           *events.Broker
+	Jobs             *jobs.Runner
+	Trash            *trash.Bin
+	Versions         *versions.Store
+	Logger           *slog.Logger
+
+	shuttingDown atomic.Bool
+	doneOnce     sync.Once
+	doneCh       chan struct{}
+
+	// inFlightMu guards adding to inFlight, so nothing is added once stopped is set and it is waited on.
+	inFlightMu sync.Mutex
+	inFlight   sync.WaitGroup
+	stopped    bool
+}
+
+// Gets the channel that is closed when the server starts shutting down.
+func (s *Server) done() chan struct{} {
+	s.doneOnce.Do(func() {
+		s.doneCh = make(chan struct{})
+	})
+	return s.doneCh
+}
+
+// Marks a request as in flight. Returns false if the server has stopped, in which case the request must
+// be rejected.
+func (s *Server) startRequest() bool {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.inFlight.Add(1)
+	return true
+}
+
+// WaitInFlight is used to wait for the requests that are being handled to finish. This is needed after
+// the HTTP server is shut down, since HTTP/2 connections are not waited for, and after it is forcibly
+// closed, since handlers can still be running to clean up. Requests that arrive after this is called are
+// rejected.
+func (s *Server) WaitInFlight(ctx context.Context) error {
+	s.inFlightMu.Lock()
+	s.stopped = true
+	s.inFlightMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Publishes an event with the DB if events are configured. The DB should be the transaction the change the
+// event describes is made in.
+func (s *Server) publish(ctx context.Context, d *db.DB, e *events.Event) error {
+	if s.Events == nil {
+		return nil
+	}
+	return s.Events.Publish(ctx, d, e)
+}
+
+// Defines a response writer that records the status and the number of bytes written.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader is used to record the status and write it.
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write is used to count the bytes written.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap is used to get the underlying response writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Gets the X-Type of an API request for metrics, or "invalid" if there is no handler for it. This stops
+// clients from creating a label for every string they send.
+func apiType(r *http.Request) string {
+	t := r.Header.Get("X-Type")
+	if _, ok := reflect.TypeOf(&apiServer{}).MethodByName(t); !ok {
+		return "invalid"
+	}
+	return t
 }
 
 // ServeHTTP is used to serve a HTTP request.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.startRequest() {
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Service Unavailable"))
+		return
+	}
+	defer s.inFlight.Done()
+
+	// Health checks are not logged or traced since load balancers make so many of them.
+	if r.Method == "GET" || r.Method == "HEAD" {
+		switch r.URL.Path {
+		case "/_contenttruck/healthz":
+			s.healthz(w, r)
+			return
+		case "/_contenttruck/readyz":
+			s.readyz(w, r)
+			return
+		}
+	}
+
+	// Tag the request with an ID so its logs can be correlated across nodes.
+	id := newRequestID(r)
+	r = s.withRequestID(r, id)
+	w.Header().Set(requestIDHeader, id)
+	w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w}
 	if r.Method == "POST" && r.URL.Path == "/_contenttruck" {
-		s.api(w, r)
+		type_ := apiType(r)
+		r, span := tracing.StartRequest(r, type_)
+		span.SetAttributes(attribute.String("contenttruck.request_id", id))
+		s.api(sw, r)
+		tracing.EndRequest(span, sw.status)
+		duration := time.Since(start)
+		labels := []string{type_, strconv.Itoa(sw.status)}
+		metrics.APIRequests.WithLabelValues(labels...).Inc()
+		metrics.APIRequestDuration.WithLabelValues(labels...).Observe(duration.Seconds())
+		s.log(r.Context()).Info("API request", "type", type_, "status", sw.status, "duration", duration,
+			"client_ip", clientIP(r, s.Config.TrustProxyHeaders))
+		return
+	}
+	if r.Method == "GET" && r.URL.Path == "/_contenttruck/events" {
+		s.eventStream(sw, r)
 		return
 	}
-	s.getContent(w, r)
+	r, span := tracing.StartRequest(r, r.Method)
+	span.SetAttributes(attribute.String("contenttruck.request_id", id))
+	s.getContent(sw, r)
+	tracing.EndRequest(span, sw.status)
+	metrics.ContentRequests.WithLabelValues(strconv.Itoa(sw.status)).Inc()
+	s.log(r.Context()).Info("Content request", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery,
+		"status", sw.status, "bytes", sw.bytes, "duration", time.Since(start),
+		"client_ip", clientIP(r, s.Config.TrustProxyHeaders), "user_agent", r.UserAgent(), "referer", r.Referer())
 }
@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+
+	"contenttruck/db"
+)
+
+// GetJobRequest is used to define the get job request.
+type GetJobRequest struct {
+	SudoKey string `json:"sudo_key"`
+	ID      int64  `json:"id"`
+}
+
+// GetJobResponse is used to define the get job response. Status is "running" until the job is finished,
+// then "done". LastError is why the last attempt failed if the job is being retried.
+type GetJobResponse struct {
+	ID         int64      `json:"id"`
+	Type       string     `json:"type"`
+	Partition  string     `json:"partition"`
+	Status     string     `json:"status"`
+	Total      int64      `json:"total"`
+	Done       int64      `json:"done"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// GetJob is used to get the progress of a job.
+func (s *apiServer) GetJob(r *http.Request, req *GetJobRequest) (*GetJobResponse, *APIError) {
+	// Validate the sudo key.
+	err := s.validateSudoKey(req.SudoKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the job.
+	job, e2 := s.s.DB.GetJob(r.Context(), req.ID)
+	if e2 != nil {
+		if e2 == db.ErrJobNotExists {
+			return nil, &APIError{
+				status:  http.StatusNotFound,
+				Code:    ErrorCodeJobNotFound,
+				Message: "Job not found",
+			}
+		}
+		s.s.log(r.Context()).Error("Error getting job", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+
+	// Return the job.
+	status := "running"
+	if job.FinishedAt != nil {
+		status = "done"
+	}
+	return &GetJobResponse{
+		ID:         job.ID,
+		Type:       job.Type,
+		Partition:  job.Partition,
+		Status:     status,
+		Total:      job.Total,
+		Done:       job.Done,
+		LastError:  job.LastError,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}, nil
+}
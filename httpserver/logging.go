@@ -0,0 +1,61 @@
+package httpserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Defines the header used to correlate the logs for a request.
+const requestIDHeader = "X-Request-Id"
+
+// Defines the context keys for the request ID and logger.
+type (
+	requestIDKey struct{}
+	loggerKey    struct{}
+)
+
+// Gets the request ID from the header if it is safe to log, or generates one if not.
+func newRequestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		return uuid.Must(uuid.NewRandom()).String()
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return uuid.Must(uuid.NewRandom()).String()
+		}
+	}
+	return id
+}
+
+// Gets the request ID from the context.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Adds the request ID and a logger that includes it to the request.
+func (s *Server) withRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+	ctx = context.WithValue(ctx, loggerKey{}, s.logger().With("request_id", id))
+	return r.WithContext(ctx)
+}
+
+// Gets the logger for the server.
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+// Gets the logger for the request, which includes the request ID.
+func (s *Server) log(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return s.logger()
+}
@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_newRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"blank", "", false},
+		{"valid", "abc-123", true},
+		{"too long", strings.Repeat("a", 129), false},
+		{"space", "abc 123", false},
+		{"newline", "abc\n123", false},
+		{"unicode", "abcé", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}}
+			r.Header.Set(requestIDHeader, tt.header)
+			got := newRequestID(r)
+			if got == "" {
+				t.Fatal("request ID is blank")
+			}
+			if (got == tt.header) != tt.keep {
+				t.Errorf("newRequestID() = %q, want keep %v", got, tt.keep)
+			}
+		})
+	}
+}
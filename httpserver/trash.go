@@ -0,0 +1,303 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"contenttruck/db"
+	"contenttruck/events"
+	"contenttruck/storage"
+	"contenttruck/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines the page sizes for the trash.
+const (
+	defaultTrashLimit = 100
+	maxTrashLimit     = 1000
+)
+
+func (r *RestoreRequest) auditKey() string    { return r.Key }
+func (r *PurgeTrashRequest) auditKey() string { return r.Key }
+
+// TrashEntry is used to define a file in the trash. Path is the full path the file was deleted from.
+type TrashEntry struct {
+	ID        int64     `json:"id"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ListTrashRequest is used to define the list trash request. Cursor is the NextCursor from the previous page.
+type ListTrashRequest struct {
+	Key       string `json:"key"`
+	Partition string `json:"partition"`
+	Cursor    string `json:"cursor,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// ListTrashResponse is used to define the list trash response. NextCursor is blank on the last page.
+type ListTrashResponse struct {
+	Files      []*TrashEntry `json:"files"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// ListTrash is used to list the files in the trash of a partition, most recently deleted first.
+func (s *apiServer) ListTrash(r *http.Request, req *ListTrashRequest) (*ListTrashResponse, *APIError) {
+	partition, err := s.keyPartition(r.Context(), req.Key, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out the page.
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultTrashLimit
+	} else if limit > maxTrashLimit {
+		limit = maxTrashLimit
+	}
+	var before int64
+	if req.Cursor != "" {
+		var e2 error
+		if before, e2 = strconv.ParseInt(req.Cursor, 10, 64); e2 != nil || before <= 0 {
+			return nil, &APIError{
+				status:  http.StatusBadRequest,
+				Code:    ErrorTypeInvalidJSON,
+				Message: "Invalid cursor",
+			}
+		}
+	}
+
+	// Get the files.
+	items, e2 := s.s.DB.ListTrash(r.Context(), partition.Name, before, limit)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error listing trash", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	resp := &ListTrashResponse{Files: make([]*TrashEntry, len(items))}
+	for i, v := range items {
+		resp.Files[i] = &TrashEntry{
+			ID:        v.ID,
+			Path:      v.Path,
+			Size:      v.Size,
+			DeletedAt: v.DeletedAt,
+			ExpiresAt: v.ExpiresAt,
+		}
+	}
+	if len(items) == limit {
+		resp.NextCursor = strconv.FormatInt(items[len(items)-1].ID, 10)
+	}
+	return resp, nil
+}
+
+// RestoreRequest is used to define the restore request.
+type RestoreRequest struct {
+	Key       string `json:"key"`
+	Partition string `json:"partition"`
+	ID        int64  `json:"id"`
+}
+
+// RestoreResponse is used to define the restore response.
+type RestoreResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Restore is used to move a file from the trash back to where it was deleted from. The file counts against
+// the partition's limits again, and it is not restored if there is a file there already.
+func (s *apiServer) Restore(r *http.Request, req *RestoreRequest) (*RestoreResponse, *APIError) {
+	s.audit.Partition = req.Partition
+	partition, err := s.keyPartition(r.Context(), req.Key, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Take the file out of the trash so it cannot be restored twice. It is put back if restoring fails.
+	ctx, span := tracing.Start(r.Context(), "TakeTrash")
+	item, e2 := s.s.DB.TakeTrash(ctx, partition.Name, req.ID)
+	tracing.End(span, e2)
+	if e2 != nil {
+		if e2 == db.ErrTrashNotExists {
+			return nil, &APIError{
+				status:  http.StatusNotFound,
+				Code:    ErrorCodeTrashNotFound,
+				Message: "File not found in trash",
+			}
+		}
+		s.s.log(r.Context()).Error("Error taking file from trash", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	s.audit.Path = item.Path
+	s.audit.Bytes = item.Size
+	rollback := true
+	defer func() {
+		if rollback {
+			if err := s.s.DB.PutTrash(context.WithoutCancel(r.Context()), item); err != nil {
+				s.s.log(r.Context()).Error("Error putting file back in trash", "err", err)
+			}
+		}
+	}()
+
+	// Make sure nothing has been uploaded to the path since, then record the file so nothing can be.
+	_, e2 = s.s.S3.HeadObjectWithContext(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.s.Config.BucketName),
+		Key:    aws.String(item.Path),
+	})
+	if e2 == nil {
+		return nil, fileExistsError()
+	}
+	if !isNotFound(e2) {
+		s.s.log(r.Context()).Error("Error stating in S3", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	ctx, span = tracing.Start(r.Context(), "ClaimPartitionFile")
+	e2 = s.s.DB.ClaimPartitionFile(ctx, partition.Name, item.Path)
+	tracing.End(span, e2)
+	if e2 != nil {
+		if e2 == db.ErrFileExists {
+			return nil, fileExistsError()
+		}
+		s.s.log(r.Context()).Error("Error claiming partition file", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	defer func() {
+		if rollback {
+			ctx, span := tracing.Start(context.WithoutCancel(r.Context()), "DeletePartitionFile")
+			err := s.s.DB.DeletePartitionFile(ctx, partition.Name, item.Path)
+			tracing.End(span, err)
+			if err != nil {
+				s.s.log(r.Context()).Error("Error deleting partition file", "err", err)
+			}
+		}
+	}()
+
+	// Allocate the space from the partition.
+	if err := s.reserve(r, partition, item.Path, item.Size, 1); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rollback {
+			s.release(r, partition, item.Size, 1)
+		}
+	}()
+
+	// Copy the file back.
+	ctx, span = tracing.Start(r.Context(), "storage.Copy")
+	e2 = storage.Copy(ctx, s.s.S3, s.s.Config.BucketName, item.Key(), item.Path, s3.ObjectCannedACLPublicRead, item.Size)
+	tracing.End(span, e2)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error copying file from trash", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+
+	// Publish the event. The file is deleted again if this fails, so the event is only sent if the file is
+	// restored.
+	e2 = s.s.DB.Tx(r.Context(), func(tx *db.DB) error {
+		return s.s.publish(r.Context(), tx, &events.Event{
+			Type:      events.EventFileRestored,
+			Partition: partition.Name,
+			Path:      item.Path,
+			Size:      item.Size,
+		})
+	})
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error publishing event", "err", e2)
+		_, err := s.s.S3.DeleteObjectWithContext(context.WithoutCancel(r.Context()), &s3.DeleteObjectInput{
+			Bucket: aws.String(s.s.Config.BucketName),
+			Key:    aws.String(item.Path),
+		})
+		if err != nil {
+			s.s.log(r.Context()).Error("Error deleting restored file", "err", err)
+		}
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	rollback = false
+
+	// Delete the copy in the trash. If this fails, garbage collection deletes it since it is not in the
+	// trash anymore.
+	_, e2 = s.s.S3.DeleteObjectWithContext(context.WithoutCancel(r.Context()), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.s.Config.BucketName),
+		Key:    aws.String(item.Key()),
+	})
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error deleting file from trash", "err", e2)
+	}
+
+	return &RestoreResponse{Path: item.Path, Size: item.Size}, nil
+}
+
+// PurgeTrashRequest is used to define the purge trash request. If IDs is empty, the whole trash is purged.
+type PurgeTrashRequest struct {
+	Key       string  `json:"key"`
+	Partition string  `json:"partition"`
+	IDs       []int64 `json:"ids,omitempty"`
+}
+
+// PurgeTrashResponse is used to define the purge trash response.
+type PurgeTrashResponse struct {
+	Purged int `json:"purged"`
+}
+
+// PurgeTrash is used to delete files in the trash of a partition forever.
+func (s *apiServer) PurgeTrash(r *http.Request, req *PurgeTrashRequest) (*PurgeTrashResponse, *APIError) {
+	s.audit.Partition = req.Partition
+	partition, err := s.keyPartition(r.Context(), req.Key, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Purge the files.
+	var (
+		purged int
+		e2     error
+	)
+	ctx, span := tracing.Start(r.Context(), "trash.Purge")
+	if len(req.IDs) == 0 {
+		purged, e2 = s.s.Trash.PurgePartition(ctx, partition.Name)
+	} else {
+		var items []*db.TrashItem
+		items, e2 = s.s.DB.GetTrash(ctx, partition.Name, req.IDs)
+		if e2 == nil {
+			e2 = s.s.Trash.Purge(ctx, items)
+			purged = len(items)
+		}
+	}
+	tracing.End(span, e2)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error purging trash", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	return &PurgeTrashResponse{Purged: purged}, nil
+}
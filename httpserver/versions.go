@@ -0,0 +1,219 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"contenttruck/db"
+	"contenttruck/events"
+	"contenttruck/storage"
+	"contenttruck/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func (r *RestoreVersionRequest) auditKey() string { return r.Key }
+
+// VersionEntry is used to define a previous version of a file. It can be fetched by adding ?version=<id>
+// to the path of the file.
+type VersionEntry struct {
+	ID        int64     `json:"id"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListVersionsRequest is used to define the list versions request.
+type ListVersionsRequest struct {
+	Key          string `json:"key"`
+	Partition    string `json:"partition"`
+	RelativePath string `json:"relative_path"`
+}
+
+// ListVersionsResponse is used to define the list versions response.
+type ListVersionsResponse struct {
+	Versions []*VersionEntry `json:"versions"`
+}
+
+// ListVersions is used to list the previous versions of a file, newest first.
+func (s *apiServer) ListVersions(r *http.Request, req *ListVersionsRequest) (*ListVersionsResponse, *APIError) {
+	partition, err := s.keyPartition(r.Context(), req.Key, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the versions.
+	versions, e2 := s.s.DB.ListVersions(r.Context(), partition.Name, partition.Join(req.RelativePath), 0)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error listing versions", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	resp := &ListVersionsResponse{Versions: make([]*VersionEntry, len(versions))}
+	for i, v := range versions {
+		resp.Versions[i] = &VersionEntry{ID: v.ID, Size: v.Size, CreatedAt: v.CreatedAt}
+	}
+	return resp, nil
+}
+
+// RestoreVersionRequest is used to define the restore version request.
+type RestoreVersionRequest struct {
+	Key          string `json:"key"`
+	Partition    string `json:"partition"`
+	RelativePath string `json:"relative_path"`
+	ID           int64  `json:"id"`
+}
+
+// RestoreVersionResponse is used to define the restore version response.
+type RestoreVersionResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// RestoreVersion is used to make a previous version of a file the current one. The current file becomes a
+// version, so this can be undone.
+func (s *apiServer) RestoreVersion(r *http.Request, req *RestoreVersionRequest) (*RestoreVersionResponse, *APIError) {
+	s.audit.Partition = req.Partition
+	partition, err := s.keyPartition(r.Context(), req.Key, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+	p := partition.Join(req.RelativePath)
+	s.audit.Path = p
+
+	// Take the version so it cannot be restored twice. It is put back if restoring fails.
+	ctx, span := tracing.Start(r.Context(), "TakeVersion")
+	version, e2 := s.s.DB.TakeVersion(ctx, partition.Name, p, req.ID)
+	tracing.End(span, e2)
+	if e2 != nil {
+		if e2 == db.ErrVersionNotExists {
+			return nil, &APIError{
+				status:  http.StatusNotFound,
+				Code:    ErrorCodeVersionNotFound,
+				Message: "Version not found",
+			}
+		}
+		s.s.log(r.Context()).Error("Error taking version", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	s.audit.Bytes = version.Size
+	rollback := true
+	defer func() {
+		if rollback {
+			if err := s.s.DB.PutVersion(context.WithoutCancel(r.Context()), version); err != nil {
+				s.s.log(r.Context()).Error("Error putting version back", "err", err)
+			}
+		}
+	}()
+
+	// Keep the current file as a version. The space the restored version used moves to the file, so only
+	// a new file needs to be allocated if there is no current file.
+	st, e2 := s.s.S3.HeadObjectWithContext(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.s.Config.BucketName),
+		Key:    aws.String(p),
+	})
+	newFiles := 0
+	switch {
+	case e2 == nil:
+		if owner := objectPartition(st.Metadata); partition.Immutable || (owner != "" && owner != partition.Name) {
+			return nil, fileExistsError()
+		}
+		ctx, span := tracing.Start(r.Context(), "versions.Save")
+		current, e2 := s.s.Versions.Save(ctx, partition, p, *st.ContentLength)
+		tracing.End(span, e2)
+		if e2 != nil {
+			s.s.log(r.Context()).Error("Error saving version", "err", e2)
+			return nil, &APIError{
+				status:  http.StatusInternalServerError,
+				Code:    ErrorCodeInternalServerError,
+				Message: "Internal Server Error",
+			}
+		}
+		defer func() {
+			if rollback {
+				_, err := s.s.Versions.Delete(context.WithoutCancel(r.Context()), []*db.Version{current})
+				if err != nil {
+					s.s.log(r.Context()).Error("Error deleting version", "err", err)
+				}
+			}
+		}()
+	case isNotFound(e2):
+		newFiles = 1
+		if err := s.reserve(r, partition, p, 0, newFiles); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if rollback {
+				s.release(r, partition, 0, newFiles)
+			}
+		}()
+	default:
+		s.s.log(r.Context()).Error("Error stating in S3", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+
+	// Copy the version back.
+	ctx, span = tracing.Start(r.Context(), "storage.Copy")
+	e2 = storage.Copy(ctx, s.s.S3, s.s.Config.BucketName, version.Key(), p, s3.ObjectCannedACLPublicRead, version.Size)
+	tracing.End(span, e2)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error copying version", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+
+	// Record the file if it is new, and publish the event together.
+	ctx, span = tracing.Start(r.Context(), "WritePartitionFile")
+	e2 = s.s.DB.Tx(ctx, func(tx *db.DB) error {
+		if newFiles != 0 {
+			if err := tx.WritePartitionFile(ctx, partition.Name, p); err != nil {
+				return err
+			}
+		}
+		return s.s.publish(ctx, tx, &events.Event{
+			Type:      events.EventFileRestored,
+			Partition: partition.Name,
+			Path:      p,
+			Size:      version.Size,
+		})
+	})
+	tracing.End(span, e2)
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error writing partition file", "err", e2)
+		return nil, &APIError{
+			status:  http.StatusInternalServerError,
+			Code:    ErrorCodeInternalServerError,
+			Message: "Internal Server Error",
+		}
+	}
+	rollback = false
+
+	// Delete the copy of the version. If this fails, garbage collection deletes it since it is not a
+	// version anymore.
+	_, e2 = s.s.S3.DeleteObjectWithContext(context.WithoutCancel(r.Context()), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.s.Config.BucketName),
+		Key:    aws.String(version.Key()),
+	})
+	if e2 != nil {
+		s.s.log(r.Context()).Error("Error deleting version", "err", e2)
+	}
+
+	// Delete the versions the partition does not keep, in case it keeps fewer than when they were saved.
+	s.pruneVersions(r, partition, p)
+
+	return &RestoreVersionResponse{Path: p, Size: version.Size}, nil
+}
@@ -0,0 +1,248 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"contenttruck/db"
+	"contenttruck/trash"
+	"contenttruck/versions"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines the settings for running jobs.
+const (
+	jobLease          = 5 * time.Minute
+	jobRetryDelay     = time.Minute
+	jobPollInterval   = 5 * time.Second
+	deleteBatchSize   = 1000
+	deleteConcurrency = 4
+)
+
+// Runner is used to run jobs in the background. This can run on every node since jobs are claimed, and
+// jobs are picked up by another node if the node running them dies.
+type Runner struct {
+	DB     *db.DB
+	S3     *s3.S3
+	Bucket string
+
+	wakeOnce sync.Once
+	wakeCh   chan struct{}
+}
+
+// Gets the channel that is sent to when there is a new job.
+func (r *Runner) wake() chan struct{} {
+	r.wakeOnce.Do(func() {
+		r.wakeCh = make(chan struct{}, 1)
+	})
+	return r.wakeCh
+}
+
+// Wake is used to look for jobs straight away rather than at the next poll. This is safe to call on a nil
+// runner.
+func (r *Runner) Wake() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.wake() <- struct{}{}:
+	default:
+	}
+}
+
+// Run is used to run jobs until the context is cancelled.
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := r.DB.ClaimJob(ctx, jobLease)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Error claiming job", "err", err)
+		}
+		if job != nil {
+			r.run(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake():
+		}
+	}
+}
+
+// Runs a job and records the result. The result is recorded even if the context is cancelled, since the
+// lease will not have expired.
+func (r *Runner) run(ctx context.Context, job *db.Job) {
+	log := slog.With("job", job.ID, "type", job.Type, "partition", job.Partition)
+	var err error
+	switch job.Type {
+	case db.JobDeletePartition:
+		err = r.deletePartition(ctx, job)
+	default:
+		err = fmt.Errorf("unknown job type %q", job.Type)
+	}
+
+	bg := context.WithoutCancel(ctx)
+	switch {
+	case err == nil:
+		err = r.DB.FinishJob(bg, job.ID)
+		if err != nil {
+			log.Error("Error finishing job", "err", err)
+			return
+		}
+		log.Info("Finished job")
+	case ctx.Err() != nil:
+		// Release the job so another node can carry on with it straight away.
+		err = r.DB.RetryJob(bg, job.ID, time.Now(), job.LastError)
+		if err != nil {
+			log.Error("Error releasing job", "err", err)
+		}
+	default:
+		log.Error("Error running job", "err", err)
+		err = r.DB.RetryJob(bg, job.ID, time.Now().Add(jobRetryDelay), err.Error())
+		if err != nil {
+			log.Error("Error scheduling job retry", "err", err)
+		}
+	}
+}
+
+// Deletes the files of a deleted partition. This is done in passes until a pass finds nothing, since
+// uploads that were in progress when the partition was deleted can record files after a pass. The trash and
+// versions of the partition are deleted afterwards, since requests that were in progress can add to them.
+func (r *Runner) deletePartition(ctx context.Context, job *db.Job) error {
+	for {
+		deleted, err := r.deletePass(ctx, job)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			break
+		}
+	}
+	bin := &trash.Bin{DB: r.DB, S3: r.S3, Bucket: r.Bucket}
+	if _, err := bin.PurgePartition(ctx, job.Partition); err != nil {
+		return err
+	}
+	store := &versions.Store{DB: r.DB, S3: r.S3, Bucket: r.Bucket}
+	_, err := store.DeletePartition(ctx, job.Partition)
+	return err
+}
+
+// Deletes the files recorded for a partition in batches. Returns how many were deleted.
+func (r *Runner) deletePass(ctx context.Context, job *db.Job) (int64, error) {
+	var (
+		mu       sync.Mutex
+		deleted  int64
+		firstErr error
+	)
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, deleteConcurrency)
+	after := ""
+	for {
+		// Stop if a batch failed.
+		mu.Lock()
+		err := firstErr
+		mu.Unlock()
+		if err != nil {
+			break
+		}
+
+		// Get the next batch.
+		paths, err := r.DB.ListPartitionFilesAfter(ctx, job.Partition, after, deleteBatchSize)
+		if err != nil {
+			mu.Lock()
+			firstErr = err
+			mu.Unlock()
+			break
+		}
+		if len(paths) == 0 {
+			break
+		}
+		after = paths[len(paths)-1]
+
+		// Delete it once there is a free slot.
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			firstErr = ctx.Err()
+			mu.Unlock()
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				n, err := r.deleteBatch(ctx, job, paths)
+				mu.Lock()
+				deleted += n
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}()
+		}
+		if len(paths) < deleteBatchSize {
+			break
+		}
+	}
+	wg.Wait()
+	return deleted, firstErr
+}
+
+// Deletes a batch of files from storage, then forgets the ones that were deleted and records the
+// progress. Files that another partition also records are only forgotten, since deleting them would
+// delete them from that partition too. Returns how many were deleted.
+func (r *Runner) deleteBatch(ctx context.Context, job *db.Job, paths []string) (int64, error) {
+	shared, err := r.DB.FilesInOtherPartitions(ctx, job.Partition, paths)
+	if err != nil {
+		return 0, err
+	}
+	objects := make([]*s3.ObjectIdentifier, 0, len(paths))
+	for _, v := range paths {
+		if !shared[v] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(v)})
+		}
+	}
+
+	// Keep the records of the files that could not be deleted so they are tried again.
+	failed := map[string]bool{}
+	var lastErr error
+	if len(objects) != 0 {
+		out, err := r.S3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(r.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, e := range out.Errors {
+			failed[aws.StringValue(e.Key)] = true
+			lastErr = fmt.Errorf("%s: %s", aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+	}
+	deleted := make([]string, 0, len(paths))
+	for _, v := range paths {
+		if !failed[v] {
+			deleted = append(deleted, v)
+		}
+	}
+	if len(deleted) != 0 {
+		if err = r.DB.DeletePartitionFilePaths(ctx, job.Partition, deleted); err != nil {
+			return 0, err
+		}
+		if err = r.DB.RecordJobProgress(ctx, job.ID, int64(len(deleted)), jobLease); err != nil {
+			return int64(len(deleted)), err
+		}
+	}
+	if lastErr != nil {
+		return int64(len(deleted)), fmt.Errorf("failed to delete %d objects: %w", len(failed), lastErr)
+	}
+	return int64(len(deleted)), nil
+}
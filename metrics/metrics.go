@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry is used to define the registry that all of the contenttruck metrics are registered with.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Defines the metrics.
+var (
+	// APIRequests is used to count API requests by X-Type and status.
+	APIRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_api_requests_total",
+		Help: "The number of API requests by X-Type and status.",
+	}, []string{"type", "status"})
+
+	// APIRequestDuration is used to observe how long API requests take by X-Type and status.
+	APIRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "contenttruck_api_request_duration_seconds",
+		Help:    "How long API requests take by X-Type and status.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"type", "status"})
+
+	// ContentRequests is used to count requests for content by status.
+	ContentRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_content_requests_total",
+		Help: "The number of requests for content by status.",
+	}, []string{"status"})
+
+	// UploadedBytes is used to count the bytes uploaded to each partition.
+	UploadedBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_uploaded_bytes_total",
+		Help: "The number of bytes uploaded by partition.",
+	}, []string{"partition"})
+
+	// ServedBytes is used to count the bytes served from each partition. Files uploaded before the
+	// partition was stored with them have a blank partition.
+	ServedBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_served_bytes_total",
+		Help: "The number of bytes served by partition.",
+	}, []string{"partition"})
+
+	// QuotaRejections is used to count uploads rejected because the partition was full.
+	QuotaRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_quota_rejections_total",
+		Help: "The number of uploads rejected because the partition was full.",
+	}, []string{"partition"})
+
+	// ResizeDuration is used to observe how long image resizes take.
+	ResizeDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "contenttruck_resize_duration_seconds",
+		Help:    "How long decoding, resizing and encoding images takes.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+
+	// ValidationFailures is used to count failed validations by the validator that failed.
+	ValidationFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_validation_failures_total",
+		Help: "The number of uploads that failed validation by validator.",
+	}, []string{"validator"})
+
+	// S3Errors is used to count errors from S3 by operation and error code.
+	S3Errors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_s3_errors_total",
+		Help: "The number of errors from S3 by operation and error code.",
+	}, []string{"operation", "code"})
+
+	// PostgresErrors is used to count errors from Postgres by operation.
+	PostgresErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "contenttruck_postgres_errors_total",
+		Help: "The number of errors from Postgres by operation.",
+	}, []string{"operation"})
+)
+
+// Handler is used to get the HTTP handler that serves the metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
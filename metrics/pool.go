@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defines the descriptions of the connection pool metrics.
+var (
+	poolAcquiredConns = prometheus.NewDesc(
+		"contenttruck_pgxpool_acquired_conns", "The number of connections currently in use.", nil, nil)
+	poolIdleConns = prometheus.NewDesc(
+		"contenttruck_pgxpool_idle_conns", "The number of idle connections in the pool.", nil, nil)
+	poolTotalConns = prometheus.NewDesc(
+		"contenttruck_pgxpool_total_conns", "The total number of connections in the pool.", nil, nil)
+	poolMaxConns = prometheus.NewDesc(
+		"contenttruck_pgxpool_max_conns", "The maximum size of the pool.", nil, nil)
+	poolAcquires = prometheus.NewDesc(
+		"contenttruck_pgxpool_acquires_total", "The number of successful connection acquires.", nil, nil)
+	poolCanceledAcquires = prometheus.NewDesc(
+		"contenttruck_pgxpool_canceled_acquires_total", "The number of acquires cancelled by a context.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc(
+		"contenttruck_pgxpool_empty_acquires_total", "The number of acquires that waited for a connection.", nil, nil)
+	poolAcquireDuration = prometheus.NewDesc(
+		"contenttruck_pgxpool_acquire_duration_seconds_total", "The total time spent acquiring connections.", nil, nil)
+)
+
+// Defines a collector that reads the stats of a connection pool when scraped.
+type poolCollector struct {
+	stat func() *pgxpool.Stat
+}
+
+// RegisterPool is used to register the stats of the connection pool.
+func RegisterPool(stat func() *pgxpool.Stat) {
+	Registry.MustRegister(poolCollector{stat: stat})
+}
+
+// Describe is used to send the descriptions of the metrics.
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		poolAcquiredConns, poolIdleConns, poolTotalConns, poolMaxConns,
+		poolAcquires, poolCanceledAcquires, poolEmptyAcquires, poolAcquireDuration,
+	} {
+		ch <- d
+	}
+}
+
+// Collect is used to send the current stats.
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquires, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDuration, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
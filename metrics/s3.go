@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// InstrumentS3 is used to count the errors from every request the S3 client makes. Not found errors are
+// not counted since they are expected.
+func InstrumentS3(client *s3.S3) {
+	client.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error == nil {
+			return
+		}
+		if r.HTTPResponse != nil && r.HTTPResponse.StatusCode == http.StatusNotFound {
+			return
+		}
+		code := "unknown"
+		if awsErr, ok := r.Error.(awserr.Error); ok {
+			code = awsErr.Code()
+		}
+		S3Errors.WithLabelValues(r.Operation.Name, code).Inc()
+	})
+}
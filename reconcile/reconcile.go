@@ -0,0 +1,261 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"contenttruck/db"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Discrepancy is used to define how the records for a partition differ from what is in storage.
+type Discrepancy struct {
+	Partition     string
+	RecordedSize  int64
+	ActualSize    int64
+	RecordedFiles int
+	ActualFiles   int
+
+	// MissingFiles are in storage but are not recorded, and StaleFiles are recorded but are not in storage.
+	MissingFiles []string
+	StaleFiles   []string
+}
+
+// Empty is used to check if the records match storage.
+func (d *Discrepancy) Empty() bool {
+	return d.RecordedSize == d.ActualSize && d.RecordedFiles == d.ActualFiles && len(d.MissingFiles) == 0 &&
+		len(d.StaleFiles) == 0
+}
+
+// Reconciler is used to recompute the usage and files of partitions from what is in storage.
+type Reconciler struct {
+	DB     *db.DB
+	S3     *s3.S3
+	Bucket string
+}
+
+// Defines an object in storage.
+type object struct {
+	size     int64
+	modified time.Time
+}
+
+// Lists the objects that could belong to the partition.
+func (r *Reconciler) list(ctx context.Context, p *db.Partition) (map[string]object, error) {
+	objects := map[string]object{}
+
+	// Uploads with no relative path, and uploads to exact partitions, are stored at the path itself.
+	head, err := r.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.Bucket),
+		Key:    aws.String(p.PathPrefix),
+	})
+	if err == nil {
+		objects[p.PathPrefix] = object{aws.Int64Value(head.ContentLength), aws.TimeValue(head.LastModified)}
+	} else if awsErr, ok := err.(awserr.Error); !ok || (awsErr.Code() != "NotFound" && awsErr.Code() != "NoSuchKey") {
+		return nil, err
+	}
+	if p.Exact {
+		return objects, nil
+	}
+
+	// List everything under the prefix.
+	err = r.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.Bucket),
+		Prefix: aws.String(strings.TrimPrefix(p.PathPrefix, "/") + "/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range page.Contents {
+			objects[aws.StringValue(o.Key)] = object{aws.Int64Value(o.Size), aws.TimeValue(o.LastModified)}
+		}
+		return true
+	})
+	return objects, err
+}
+
+// Compares the recorded usage and files of a partition with storage. Objects modified since the usage was
+// read are left alone since the records may not have caught up with them yet. If countRecent is true, the
+// ones that belong to the partition are counted though, which is only right if the usage is then checked not
+// to have changed, since the uploads of them must have reserved it before it was read.
+func (r *Reconciler) check(ctx context.Context, partitions []*db.Partition, p *db.Partition, recordedSize int64,
+	recordedFiles int, countRecent bool) (*Discrepancy, error) {
+	start := time.Now()
+
+	// Versions count towards the usage of the partition, but are not under its prefix.
+	versionsSize, err := r.DB.GetPartitionVersionsSize(ctx, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := r.DB.ListPartitionFiles(ctx, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	recordedSet := make(map[string]bool, len(recorded))
+	for _, v := range recorded {
+		recordedSet[v] = true
+	}
+	objects, err := r.list(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out which of the unrecorded objects belong to this partition.
+	unrecorded := make([]string, 0)
+	recent := map[string]bool{}
+	for k, o := range objects {
+		if !o.modified.Before(start) {
+			delete(recordedSet, k)
+			if countRecent && db.FindPartition(partitions, k) == p {
+				recent[k] = true
+			} else {
+				delete(objects, k)
+			}
+		} else if !recordedSet[k] {
+			if db.FindPartition(partitions, k) == p {
+				unrecorded = append(unrecorded, k)
+			} else {
+				delete(objects, k)
+			}
+		}
+	}
+	if len(unrecorded) != 0 {
+		elsewhere, err := r.DB.FilesInOtherPartitions(ctx, p.Name, unrecorded)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range unrecorded {
+			if elsewhere[k] {
+				delete(objects, k)
+			}
+		}
+	}
+
+	// Compare the records with storage.
+	d := &Discrepancy{
+		Partition: p.Name, RecordedSize: recordedSize, RecordedFiles: recordedFiles, ActualFiles: len(objects),
+		ActualSize: versionsSize, MissingFiles: []string{}, StaleFiles: []string{},
+	}
+	for k, o := range objects {
+		d.ActualSize += o.size
+		if !recordedSet[k] && !recent[k] {
+			d.MissingFiles = append(d.MissingFiles, k)
+		}
+	}
+	for k := range recordedSet {
+		if _, ok := objects[k]; !ok {
+			d.StaleFiles = append(d.StaleFiles, k)
+		}
+	}
+	sort.Strings(d.MissingFiles)
+	sort.Strings(d.StaleFiles)
+	return d, nil
+}
+
+// Defines how many times fixing a partition is tried if its usage keeps changing whilst it is checked.
+const fixAttempts = 3
+
+// Partition is used to compare the records for a partition with storage, and correct them if fix is
+// true. All of the partitions are needed to work out which partition unrecorded files belong to.
+func (r *Reconciler) Partition(ctx context.Context, partitions []*db.Partition, p *db.Partition, fix bool) (*Discrepancy, error) {
+	recordedSize, recordedFiles, err := r.DB.GetPartitionUsage(ctx, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	d, err := r.check(ctx, partitions, p, recordedSize, recordedFiles, false)
+	if err != nil || !fix || d.Empty() {
+		return d, err
+	}
+
+	// Check again and only lock the usage to apply the fix, so uploads and deletions are not held up whilst
+	// storage is listed. If the usage changed in the meantime, the fix is out of date, so check again.
+	for i := 0; i < fixAttempts; i++ {
+		recordedSize, recordedFiles, err = r.DB.GetPartitionUsage(ctx, p.Name)
+		if err != nil {
+			return nil, err
+		}
+		d, err = r.check(ctx, partitions, p, recordedSize, recordedFiles, true)
+		if err != nil || d.Empty() {
+			return d, err
+		}
+		err = r.DB.FixPartition(ctx, p.Name, recordedSize, recordedFiles, &db.PartitionFix{
+			Size: d.ActualSize, Files: d.ActualFiles, Missing: d.MissingFiles, Stale: d.StaleFiles,
+		})
+		if err == nil || errors.Is(err, db.ErrPartitionNotExists) {
+			return d, nil
+		}
+		if !errors.Is(err, db.ErrPartitionUsageChanged) {
+			return nil, err
+		}
+	}
+	return nil, db.ErrPartitionUsageChanged
+}
+
+// Run is used to reconcile every partition, and correct them if fix is true. The function is called for
+// every partition with a discrepancy. Partitions that fail are skipped and their errors are returned at
+// the end.
+func (r *Reconciler) Run(ctx context.Context, fix bool, fn func(*Discrepancy)) error {
+	partitions, err := r.DB.ListPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, 0)
+	for _, p := range partitions {
+		d, err := r.Partition(ctx, partitions, p, fix)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, errors.New(p.Name+": "+err.Error()))
+			continue
+		}
+		if !d.Empty() {
+			fn(d)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunPeriodically is used to reconcile every partition on the interval until the context is cancelled.
+// This can run on every node since only the node holding the lock reconciles.
+func (r *Reconciler) RunPeriodically(ctx context.Context, interval time.Duration, fix bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		unlock, ok, err := r.DB.TryLock(ctx, db.LockReconcile)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Error taking reconciliation lock", "err", err)
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		n := 0
+		err = r.Run(ctx, fix, func(d *Discrepancy) {
+			n++
+			slog.Warn("Partition does not match storage", "partition", d.Partition,
+				"recorded_size", d.RecordedSize, "actual_size", d.ActualSize,
+				"recorded_files", d.RecordedFiles, "actual_files", d.ActualFiles,
+				"missing_files", len(d.MissingFiles), "stale_files", len(d.StaleFiles), "fixed", fix)
+		})
+		unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("Error reconciling partitions", "err", err)
+		}
+		slog.Info("Reconciled partitions", "discrepancies", n, "fixed", fix)
+	}
+}
@@ -1,11 +1,19 @@
 CREATE TABLE IF NOT EXISTS partitions (
     name VARCHAR(255) NOT NULL PRIMARY KEY,
-    max_size INTEGER NOT NULL,
+    max_size BIGINT NOT NULL,
     path_prefix TEXT NOT NULL,
     exact BOOLEAN NOT NULL,
     validates TEXT NOT NULL
 );
 
+ALTER TABLE partitions ADD COLUMN IF NOT EXISTS content_types TEXT NOT NULL DEFAULT '';
+ALTER TABLE partitions ADD COLUMN IF NOT EXISTS immutable BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE partitions ADD COLUMN IF NOT EXISTS max_file_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE partitions ADD COLUMN IF NOT EXISTS min_file_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE partitions ADD COLUMN IF NOT EXISTS max_files INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE partitions ADD COLUMN IF NOT EXISTS trash INTERVAL NOT NULL DEFAULT '0';
+ALTER TABLE partitions ADD COLUMN IF NOT EXISTS versions INTEGER NOT NULL DEFAULT 0;
+
 CREATE TABLE IF NOT EXISTS partitions_files (
     name TEXT NOT NULL,
     file_path TEXT NOT NULL,
@@ -15,13 +23,46 @@ CREATE TABLE IF NOT EXISTS partitions_files (
 );
 
 CREATE INDEX IF NOT EXISTS partitions_file_name ON partitions_files (name);
+-- Paths are compared in byte order to match the order S3 lists objects in.
+DROP INDEX IF EXISTS partitions_files_file_path;
+CREATE INDEX IF NOT EXISTS partitions_files_file_path_c ON partitions_files (file_path COLLATE "C");
+-- When the file was recorded, so garbage collection can leave the records of uploads in progress alone.
+ALTER TABLE partitions_files ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
 
 CREATE TABLE IF NOT EXISTS partitions_usage (
     name TEXT NOT NULL PRIMARY KEY,
-    size INTEGER NOT NULL,
+    size BIGINT NOT NULL,
     FOREIGN KEY (name) REFERENCES partitions(name) ON DELETE CASCADE
 );
 
+-- Sizes were 32-bit. They are only widened once since changing the type locks the table.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'partitions' AND column_name = 'max_size' AND data_type = 'integer'
+    ) THEN
+        ALTER TABLE partitions ALTER COLUMN max_size TYPE BIGINT;
+    END IF;
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'partitions_usage' AND column_name = 'size' AND data_type = 'integer'
+    ) THEN
+        ALTER TABLE partitions_usage ALTER COLUMN size TYPE BIGINT;
+    END IF;
+END $$;
+
+-- The number of files is counted from the records when the column is added.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns WHERE table_name = 'partitions_usage' AND column_name = 'files'
+    ) THEN
+        ALTER TABLE partitions_usage ADD COLUMN files INTEGER NOT NULL DEFAULT 0;
+        UPDATE partitions_usage u SET files = (SELECT count(*) FROM partitions_files f WHERE f.name = u.name);
+    END IF;
+END $$;
+
 CREATE TABLE IF NOT EXISTS keys (
     key TEXT NOT NULL,
     partition TEXT NOT NULL,
@@ -29,3 +70,108 @@ CREATE TABLE IF NOT EXISTS keys (
 );
 
 CREATE INDEX IF NOT EXISTS keys_key ON keys (key);
+
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    webhook TEXT NOT NULL,
+    event JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error TEXT NOT NULL DEFAULT '',
+    failed BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_next_attempt_at ON webhook_outbox (next_attempt_at) WHERE NOT failed;
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    type TEXT NOT NULL,
+    key_fingerprint TEXT NOT NULL,
+    partition TEXT NOT NULL,
+    path TEXT NOT NULL,
+    target_key TEXT NOT NULL,
+    client_ip TEXT NOT NULL,
+    result TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    bytes BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_time ON audit_log (time);
+CREATE INDEX IF NOT EXISTS audit_log_partition ON audit_log (partition, id);
+
+-- The audit log is append-only.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    partition TEXT NOT NULL,
+    total BIGINT NOT NULL DEFAULT 0,
+    done BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    lease_until TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS jobs_lease_until ON jobs (lease_until) WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS jobs_partition ON jobs (partition) WHERE finished_at IS NULL;
+
+-- Deleted files are kept under _contenttruck/trash/<id> until they expire. There is no foreign key to
+-- partitions(name) since the files of deleted partitions are purged in the background.
+CREATE TABLE IF NOT EXISTS trash (
+    id BIGSERIAL PRIMARY KEY,
+    partition TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS trash_partition ON trash (partition, id);
+CREATE INDEX IF NOT EXISTS trash_expires_at ON trash (expires_at);
+
+-- Previous versions of files are kept under _contenttruck/versions/<id>. Their size counts against the
+-- usage of the partition.
+CREATE TABLE IF NOT EXISTS versions (
+    id BIGSERIAL PRIMARY KEY,
+    partition TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS versions_partition_file_path ON versions (partition, file_path, id);
+
+-- Events that are too large to send in a notification are kept here for an hour, and the notification
+-- only has the id so every node can load them.
+CREATE TABLE IF NOT EXISTS stream_events (
+    id BIGSERIAL PRIMARY KEY,
+    event JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS stream_events_created_at ON stream_events (created_at);
+
+-- This must stay at the end of the file and match db.SchemaVersion, so the version is only updated once
+-- everything above has been applied. Bump both when changing the schema.
+CREATE TABLE IF NOT EXISTS schema_version (
+    id BOOLEAN NOT NULL PRIMARY KEY DEFAULT true CHECK (id),
+    version INTEGER NOT NULL
+);
+
+INSERT INTO schema_version (version) VALUES (11)
+    ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version;
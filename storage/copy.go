@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines the limits of copying objects. S3 can only copy objects up to 5GB in one request, and multipart
+// uploads can have at most 10000 parts.
+const (
+	maxCopySize  int64 = 5 * 1024 * 1024 * 1024
+	copyPartSize int64 = 512 * 1024 * 1024
+	maxCopyParts int64 = 10000
+)
+
+// Gets the copy source for a key in a bucket. Each segment of the key is escaped.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, v := range segments {
+		segments[i] = url.PathEscape(v)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// Splits an object of the size into the byte ranges of the parts to copy.
+func copyParts(size int64) []string {
+	partSize := copyPartSize
+	if n := (size + maxCopyParts - 1) / maxCopyParts; n > partSize {
+		partSize = n
+	}
+	parts := make([]string, 0, (size+partSize-1)/partSize)
+	for start := int64(0); start < size; start += partSize {
+		end := min(start+partSize, size) - 1
+		parts = append(parts, fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+	return parts
+}
+
+// Copy is used to copy an object of the size within the bucket. The content type and metadata are kept, and
+// the ACL of the copy is set to acl. Objects larger than 5GB are copied in parts.
+func Copy(ctx context.Context, client *s3.S3, bucket, from, to, acl string, size int64) error {
+	source := copySource(bucket, from)
+	if size <= maxCopySize {
+		_, err := client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(to),
+			CopySource: aws.String(source),
+			ACL:        aws.String(acl),
+		})
+		return err
+	}
+
+	// Multipart uploads do not copy the content type or metadata, so get them first.
+	head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(from),
+	})
+	if err != nil {
+		return err
+	}
+	upload, err := client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(to),
+		ACL:         aws.String(acl),
+		ContentType: head.ContentType,
+		Metadata:    head.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Copy each part, and abort the upload if any of them fail so the parts are not kept.
+	ranges := copyParts(size)
+	completed := make([]*s3.CompletedPart, len(ranges))
+	for i, v := range ranges {
+		out, err := client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(to),
+			CopySource:        aws.String(source),
+			CopySourceIfMatch: head.ETag,
+			CopySourceRange:   aws.String(v),
+			PartNumber:        aws.Int64(int64(i + 1)),
+			UploadId:          upload.UploadId,
+		})
+		if err != nil {
+			_, _ = client.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      aws.String(to),
+				UploadId: upload.UploadId,
+			})
+			return err
+		}
+		completed[i] = &s3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: aws.Int64(int64(i + 1))}
+	}
+	_, err = client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(to),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_copySource(t *testing.T) {
+	got := copySource("bucket", "images/a b+c.png")
+	if want := "bucket/images/a%20b+c.png"; got != want {
+		t.Errorf("copySource() = %q, want %q", got, want)
+	}
+}
+
+func Test_copyParts(t *testing.T) {
+	gb := int64(1024 * 1024 * 1024)
+	got := copyParts(6 * gb)
+	if len(got) != 12 {
+		t.Fatalf("copyParts() returned %d parts, want 12", len(got))
+	}
+	want := []string{"bytes=0-536870911", "bytes=536870912-1073741823"}
+	if !reflect.DeepEqual(got[:2], want) {
+		t.Errorf("copyParts()[:2] = %v, want %v", got[:2], want)
+	}
+	if last := "bytes=5905580032-6442450943"; got[11] != last {
+		t.Errorf("copyParts()[11] = %q, want %q", got[11], last)
+	}
+
+	// Objects too large for 10000 parts of the default size use larger parts.
+	if got = copyParts(10000*copyPartSize + 1); len(got) != 10000 {
+		t.Errorf("copyParts() returned %d parts, want 10000", len(got))
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines how many objects are deleted at a time. This is the most DeleteObjects accepts.
+const deleteBatchSize = 1000
+
+// Delete is used to delete objects from the bucket in batches. Returns the keys that were deleted, which
+// are all of them unless there is an error.
+func Delete(ctx context.Context, client *s3.S3, bucket string, keys []string) ([]string, error) {
+	deleted := make([]string, 0, len(keys))
+	for len(keys) != 0 {
+		batch := keys[:min(len(keys), deleteBatchSize)]
+		keys = keys[len(batch):]
+
+		objects := make([]*s3.ObjectIdentifier, len(batch))
+		for i, v := range batch {
+			objects[i] = &s3.ObjectIdentifier{Key: aws.String(v)}
+		}
+		out, err := client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		// Keep going after errors so as much as possible is deleted.
+		failed := make(map[string]bool, len(out.Errors))
+		var lastErr error
+		for _, e := range out.Errors {
+			failed[aws.StringValue(e.Key)] = true
+			lastErr = fmt.Errorf("%s: %s", aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+		for _, v := range batch {
+			if !failed[v] {
+				deleted = append(deleted, v)
+			}
+		}
+		if lastErr != nil {
+			return deleted, fmt.Errorf("failed to delete %d objects: %w", len(failed), lastErr)
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentS3 is used to create a client span for every request the S3 client makes. Retries are part of
+// the same span. For the spans to be part of a trace, the WithContext methods must be used.
+func InstrumentS3(client *s3.S3) {
+	client.Handlers.Validate.PushFront(func(r *request.Request) {
+		ctx, _ := tracer.Start(r.Context(), "S3."+r.Operation.Name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCService("S3"),
+				semconv.RPCMethod(r.Operation.Name),
+			))
+		r.SetContext(ctx)
+	})
+	client.Handlers.Complete.PushBack(func(r *request.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if r.HTTPResponse != nil {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(r.HTTPResponse.StatusCode))
+		}
+		if r.Error != nil && (r.HTTPResponse == nil || r.HTTPResponse.StatusCode != http.StatusNotFound) {
+			span.RecordError(r.Error)
+			span.SetStatus(codes.Error, r.Error.Error())
+		}
+		span.End()
+	})
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	r := httptest.NewRequest("POST", "/_contenttruck", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r, span := StartRequest(r, "Upload")
+	_, child := Start(r.Context(), "WriteToPartitionUsagePool")
+	End(child, nil)
+	EndRequest(span, http.StatusInternalServerError)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	server := spans[1]
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the one from the traceparent header", got)
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s, want the one from the traceparent header", got)
+	}
+	if spans[0].Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("stage span is not a child of the request span")
+	}
+	if server.Status().Code != codes.Error {
+		t.Error("5xx responses should mark the span as failed")
+	}
+}
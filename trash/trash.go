@@ -0,0 +1,156 @@
+package trash
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"contenttruck/db"
+	"contenttruck/storage"
+	"contenttruck/versions"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines how many items are purged at a time.
+const purgeBatchSize = 1000
+
+// Bin is used to move deleted files to the trash and purge them.
+type Bin struct {
+	DB     *db.DB
+	S3     *s3.S3
+	Bucket string
+
+	// Versions is used to delete the versions of files once they are purged, since they are kept whilst the
+	// file can be restored. If this is nil, versions are left alone.
+	Versions *versions.Store
+}
+
+// Move is used to copy a file of a partition to the trash. The file itself is left for the caller to
+// delete, and the item should be purged if that fails.
+func (b *Bin) Move(ctx context.Context, partition *db.Partition, path string, size int64) (*db.TrashItem, error) {
+	// Record the item first so the copy is never orphaned.
+	t, err := b.DB.InsertTrash(ctx, partition.Name, path, size, partition.Trash)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.Copy(ctx, b.S3, b.Bucket, path, t.Key(), s3.ObjectCannedACLPrivate, size)
+	if err != nil {
+		if err2 := b.DB.DeleteTrash(context.WithoutCancel(ctx), []int64{t.ID}); err2 != nil {
+			slog.Error("Error forgetting trash item", "err", err2, "id", t.ID)
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// Purge is used to delete items in the trash forever. Items that could not be deleted are kept so they are
+// tried again.
+func (b *Bin) Purge(ctx context.Context, items []*db.TrashItem) error {
+	byKey := make(map[string]*db.TrashItem, len(items))
+	keys := make([]string, len(items))
+	for i, v := range items {
+		keys[i] = v.Key()
+		byKey[keys[i]] = v
+	}
+	deleted, err := storage.Delete(ctx, b.S3, b.Bucket, keys)
+	if len(deleted) == 0 {
+		return err
+	}
+	ids := make([]int64, len(deleted))
+	for i, v := range deleted {
+		ids[i] = byKey[v].ID
+	}
+	if err2 := b.DB.DeleteTrash(ctx, ids); err2 != nil {
+		return err2
+	}
+	for _, v := range deleted {
+		if err2 := b.purgeVersions(ctx, byKey[v]); err2 != nil {
+			return err2
+		}
+	}
+	return err
+}
+
+// Deletes the versions of the file of a purged item if they are not needed anymore, and releases the space
+// they used from the partition.
+func (b *Bin) purgeVersions(ctx context.Context, item *db.TrashItem) error {
+	if b.Versions == nil {
+		return nil
+	}
+	state, err := b.DB.GetFileState(ctx, item.Partition, item.Path)
+	if err != nil || state.VersionsNeeded() {
+		return err
+	}
+	freed, err := b.Versions.DeletePath(ctx, &db.Partition{Name: item.Partition}, item.Path)
+	if freed != 0 {
+		if err2 := b.DB.RollbackPartitionUsagePool(ctx, item.Partition, freed, 0); err2 != nil {
+			return err2
+		}
+	}
+	return err
+}
+
+// PurgePartition is used to purge everything in the trash of a partition.
+func (b *Bin) PurgePartition(ctx context.Context, partition string) (int, error) {
+	n := 0
+	for {
+		items, err := b.DB.ListTrash(ctx, partition, 0, purgeBatchSize)
+		if err != nil || len(items) == 0 {
+			return n, err
+		}
+		if err = b.Purge(ctx, items); err != nil {
+			return n, err
+		}
+		n += len(items)
+	}
+}
+
+// Sweep is used to purge every item in the trash that has expired. Returns how many were purged.
+func (b *Bin) Sweep(ctx context.Context) (int, error) {
+	n := 0
+	for {
+		items, err := b.DB.ExpiredTrash(ctx, purgeBatchSize)
+		if err != nil || len(items) == 0 {
+			return n, err
+		}
+		if err = b.Purge(ctx, items); err != nil {
+			return n, err
+		}
+		n += len(items)
+	}
+}
+
+// RunPeriodically is used to sweep the trash on the interval until the context is cancelled. This can run
+// on every node since only the node holding the lock sweeps.
+func (b *Bin) RunPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		unlock, ok, err := b.DB.TryLock(ctx, db.LockTrash)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Error taking trash lock", "err", err)
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		n, err := b.Sweep(ctx)
+		unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("Error sweeping trash", "err", err, "purged", n)
+		} else if n != 0 {
+			slog.Info("Purged expired files from the trash", "purged", n)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package clamd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Defines the size of the chunks that are streamed to the daemon.
+const chunkSize = 64 * 1024
+
+// InfectedError is returned when the daemon found a signature in the content.
+type InfectedError struct {
+	Signature string
+}
+
+// Error is used to return the error message.
+func (e *InfectedError) Error() string {
+	return "The file specified is infected with " + e.Signature
+}
+
+// Client is used to define a client for the daemon.
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// New is used to create a client from an address in the format of "tcp://host:port" or
+// "unix:///path/to/clamd.sock". The timeout applies to the whole scan.
+func New(address string, timeout time.Duration) (*Client, error) {
+	schemeSplit := strings.SplitN(address, "://", 2)
+	if len(schemeSplit) != 2 || schemeSplit[1] == "" {
+		return nil, fmt.Errorf("invalid clamd address: %q", address)
+	}
+	switch schemeSplit[0] {
+	case "tcp", "unix":
+	default:
+		return nil, fmt.Errorf("invalid clamd address scheme: %q", schemeSplit[0])
+	}
+	return &Client{network: schemeSplit[0], address: schemeSplit[1], timeout: timeout}, nil
+}
+
+// Scan is used to stream the content to the daemon. Returns a *InfectedError if the content is infected,
+// or another error if the daemon could not be reached or could not scan the content.
+func (c *Client) Scan(ctx context.Context, r io.Reader) error {
+	if c.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	// Connect to the daemon.
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// Send the command and then the content in length prefixed chunks, followed by a zero length chunk.
+	w := bufio.NewWriterSize(conn, chunkSize+4)
+	if _, err = w.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize+4)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err = w.Write(buf[:n+4]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if _, err = w.Write([]byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	// Read the reply, which is terminated by a null byte.
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return err
+	}
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// Parses the reply from the daemon.
+func parseReply(reply string) error {
+	// Replies are in the format of "stream: OK", "stream: <signature> FOUND" or "<message> ERROR".
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &InfectedError{Signature: strings.TrimSuffix(result, " FOUND")}
+	case strings.HasSuffix(result, " ERROR"):
+		return errors.New("clamd error: " + strings.TrimSuffix(result, " ERROR"))
+	default:
+		return fmt.Errorf("unexpected clamd reply: %q", reply)
+	}
+}
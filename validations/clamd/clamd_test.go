@@ -0,0 +1,113 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Starts a fake clamd server which reports anything containing "EICAR" as infected.
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil || cmd != "zINSTREAM\x00" {
+					_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err = io.CopyN(&data, r, int64(size)); err != nil {
+						return
+					}
+				}
+				if bytes.Contains(data.Bytes(), []byte("EICAR")) {
+					_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				_, _ = conn.Write([]byte("stream: OK\x00"))
+			}()
+		}
+	}()
+	return "tcp://" + l.Addr().String()
+}
+
+func TestClient_Scan(t *testing.T) {
+	c, err := New(fakeClamd(t), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check clean content, including content over multiple chunks.
+	for _, s := range []string{"", "hello world", strings.Repeat("a", chunkSize*3+1)} {
+		if err = c.Scan(context.Background(), strings.NewReader(s)); err != nil {
+			t.Errorf("Scan() of clean content returned %v", err)
+		}
+	}
+
+	// Check infected content.
+	err = c.Scan(context.Background(), strings.NewReader(strings.Repeat("a", chunkSize)+"EICAR"))
+	var infected *InfectedError
+	if !errors.As(err, &infected) || infected.Signature != "Eicar-Test-Signature" {
+		t.Errorf("Scan() of infected content returned %v", err)
+	}
+}
+
+func TestClient_Scan_unreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	c, err := New("tcp://"+addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Scan(context.Background(), strings.NewReader("hello world"))
+	var infected *InfectedError
+	if err == nil || errors.As(err, &infected) {
+		t.Errorf("Scan() with no daemon returned %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, s := range []string{"", "localhost:3310", "http://localhost:3310", "tcp://"} {
+		if _, err := New(s, 0); err == nil {
+			t.Errorf("New(%q) did not error", s)
+		}
+	}
+	for _, s := range []string{"tcp://localhost:3310", "unix:///var/run/clamav/clamd.ctl"} {
+		if _, err := New(s, 0); err != nil {
+			t.Errorf("New(%q) returned %v", s, err)
+		}
+	}
+}
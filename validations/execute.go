@@ -1,27 +1,21 @@
 package validations
 
 import (
-	"io"
-	"strings"
-
 	"contenttruck/validations/validators"
 )
 
-// Execute is used to execute the validations.
-func Execute(r io.Reader, validations string) (io.Reader, error) {
-	b, err := io.ReadAll(r)
+// Execute is used to execute the validations against the content.
+func Execute(c *validators.Content, validations string) error {
+	expr, err := Parse(validations)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for _, v := range strings.Split(validations, "+") {
-		for _, validator := range validators.Validators {
-			if validator.Matches(v) {
-				err = validator.Validate(b, v)
-				if err != nil {
-					return nil, err
-				}
-			}
+	if err = expr.Evaluate(c); err != nil {
+		// Prefer the read error since the validators would have seen truncated content.
+		if c.Err() != nil {
+			return c.Err()
 		}
+		return err
 	}
-	return strings.NewReader(string(b)), nil
+	return c.Err()
 }
@@ -0,0 +1,202 @@
+package validations
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"contenttruck/validations/validators"
+)
+
+// Expression is used to define a parsed validation expression.
+type Expression interface {
+	// Evaluate is used to evaluate the expression against the content.
+	Evaluate(c *validators.Content) error
+}
+
+// Error is used to define a failed validation. Validator is the name of the validator that failed without
+// its arguments, "aspect-ratio" for aspect ratios, or "any" if none of the alternatives matched.
+type Error struct {
+	Validator string
+	Err       error
+}
+
+// Error is used to get the error message of the validator.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap is used to get the error from the validator.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Gets the name of the validator in a token.
+func validatorName(s string) string {
+	s = strings.SplitN(s, "=", 2)[0]
+	if strings.Contains(s, ":") {
+		return "aspect-ratio"
+	}
+	return s
+}
+
+// Defines an expression where all of the sub-expressions must pass.
+type allOf []Expression
+
+// Evaluate is used to evaluate the expression against the content.
+func (e allOf) Evaluate(c *validators.Content) error {
+	for _, v := range e {
+		if err := v.Evaluate(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Defines an expression where one of the sub-expressions must pass.
+type anyOf []Expression
+
+// Evaluate is used to evaluate the expression against the content.
+func (e anyOf) Evaluate(c *validators.Content) error {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		err := v.Evaluate(c)
+		if err == nil {
+			return nil
+		}
+		msgs[i] = err.Error()
+	}
+	return &Error{
+		Validator: "any",
+		Err:       errors.New("None of the alternatives matched: " + strings.Join(msgs, "; ")),
+	}
+}
+
+// Defines a single validator token.
+type token struct {
+	s          string
+	validators []validators.Validator
+}
+
+// Evaluate is used to evaluate the expression against the content.
+func (e *token) Evaluate(c *validators.Content) error {
+	for _, validator := range e.validators {
+		if err := validator.Validate(c, e.s); err != nil {
+			return &Error{Validator: validatorName(e.s), Err: err}
+		}
+	}
+	return nil
+}
+
+// Defines the parser state.
+type parser struct {
+	s   string
+	pos int
+}
+
+// Skips any whitespace and returns the next character, or 0 if the end of the input was reached.
+func (p *parser) peek() byte {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// Parses validators joined with a pipe, any of which must pass.
+func (p *parser) parseAnyOf() (Expression, error) {
+	var exprs anyOf
+	for {
+		expr, err := p.parseAllOf()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+// Parses validators joined with a plus, all of which must pass.
+func (p *parser) parseAllOf() (Expression, error) {
+	var exprs allOf
+	for {
+		expr, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if p.peek() != '+' {
+			break
+		}
+		p.pos++
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return exprs, nil
+}
+
+// Parses either a group in brackets or a single validator.
+func (p *parser) parsePrimary() (Expression, error) {
+	switch c := p.peek(); c {
+	case 0:
+		return nil, errors.New("expected a validator but got the end of the expression")
+	case '(':
+		start := p.pos
+		p.pos++
+		expr, err := p.parseAnyOf()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing closing bracket for the bracket at position %d", start+1)
+		}
+		p.pos++
+		return expr, nil
+	case ')', '|', '+':
+		return nil, fmt.Errorf("expected a validator but got %q at position %d", c, p.pos+1)
+	}
+
+	// Read until the next operator.
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("()|+ ", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	s := p.s[start:p.pos]
+
+	// Find the validators for the token.
+	t := &token{s: s}
+	for _, validator := range validators.Validators {
+		if validator.Matches(s) {
+			t.validators = append(t.validators, validator)
+		}
+	}
+	if len(t.validators) == 0 {
+		return nil, fmt.Errorf("unknown validator %q", s)
+	}
+	return t, nil
+}
+
+// Parse is used to parse a validations string. Validators joined with a plus must all pass, validators
+// joined with a pipe must have one pass, and brackets can be used to group validators. A plus binds
+// tighter than a pipe, so "png|jpeg+1:1" is "png|(jpeg+1:1)".
+func Parse(validations string) (Expression, error) {
+	p := &parser{s: validations}
+	expr, err := p.parseAnyOf()
+	if err != nil {
+		return nil, err
+	}
+	if c := p.peek(); c != 0 {
+		return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+	}
+	return expr, nil
+}
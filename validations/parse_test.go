@@ -0,0 +1,69 @@
+package validations
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"contenttruck/validations/validators"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s     string
+		valid bool
+	}{
+		{"png", true},
+		{"png+1:1", true},
+		{"png|jpeg", true},
+		{"(png|jpeg)+1:1", true},
+		{"( png | jpeg ) + 16:9~2%", true},
+		{"((png|jpg)+max-width=100)|svg", true},
+		{"", false},
+		{"png+", false},
+		{"|png", false},
+		{"(png|jpeg", false},
+		{"png)", false},
+		{"()", false},
+		{"png jpeg", false},
+		{"gopher", false},
+		{"png|gopher", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			_, err := Parse(tt.s)
+			if (err == nil) != tt.valid {
+				t.Errorf("Parse() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestExecuteError(t *testing.T) {
+	tests := []struct {
+		s         string
+		validator string
+	}{
+		{"png", "png"},
+		{"max-width=10", "max-width"},
+		{"16:9~2%", "aspect-ratio"},
+		{"png|jpeg", "any"},
+		{"(png|jpeg)+1:1", "any"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			c, err := validators.NewContent(strings.NewReader("hello"), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			var verr *Error
+			if err = Execute(c, tt.s); !errors.As(err, &verr) {
+				t.Fatalf("Execute() error = %v, want *Error", err)
+			}
+			if verr.Validator != tt.validator {
+				t.Errorf("Validator = %q, want %q", verr.Validator, tt.validator)
+			}
+		})
+	}
+}
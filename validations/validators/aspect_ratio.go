@@ -1,19 +1,18 @@
 package validators
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
-
-	"github.com/disintegration/imaging"
+	"strconv"
 )
 
 type aspectRatioValidator struct{}
 
 var _ Validator = (*aspectRatioValidator)(nil)
 
-var aspectRatioRegex = regexp.MustCompile(`^(\d+):(\d+)$`)
+var aspectRatioRegex = regexp.MustCompile(`^(\d+):(\d+)(?:~(\d+(?:\.\d+)?)%)?$`)
 
 // Matches is used to check if a validator matches a string.
 func (p *aspectRatioValidator) Matches(s string) bool {
@@ -37,16 +36,37 @@ func calculateAspectRatio(width, height int) string {
 	return fmt.Sprintf("%d:%d", aspectRatioWidth, aspectRatioHeight)
 }
 
-// Validate is used to validate a byte slice is the aspect ratio specified.
-func (p *aspectRatioValidator) Validate(b []byte, s string) error {
-	img, err := imaging.Decode(bytes.NewReader(b))
+// Checks if a width and height is within the tolerance percentage of the aspect ratio X:Y.
+func aspectRatioWithin(width, height int, x, y, tolerance float64) bool {
+	if width == 0 || height == 0 || x == 0 || y == 0 {
+		return false
+	}
+	ratio := (float64(width) / float64(height)) / (x / y)
+	return math.Abs(ratio-1)*100 <= tolerance
+}
+
+// Validate is used to validate the content is the aspect ratio specified.
+func (p *aspectRatioValidator) Validate(c *Content, s string) error {
+	// Only decode the image config since we just need the dimensions.
+	conf, err := imageConfig(c)
 	if err != nil {
-		return errors.New("The image specified is not a valid image")
+		return err
+	}
+
+	// Handle if there is a tolerance.
+	m := aspectRatioRegex.FindStringSubmatch(s)
+	if m[3] != "" {
+		x, _ := strconv.ParseFloat(m[1], 64)
+		y, _ := strconv.ParseFloat(m[2], 64)
+		tolerance, _ := strconv.ParseFloat(m[3], 64)
+		if !aspectRatioWithin(conf.Width, conf.Height, x, y, tolerance) {
+			return errors.New("The image specified is not within the tolerance of the aspect ratio")
+		}
+		return nil
 	}
-	bounds := img.Bounds()
 
 	// Calculate the aspect ratio.
-	aspectRatio := calculateAspectRatio(bounds.Dx(), bounds.Dy())
+	aspectRatio := calculateAspectRatio(conf.Width, conf.Height)
 
 	// Check if the aspect ratio matches.
 	if aspectRatio != s {
@@ -29,3 +29,30 @@ func Test_calculateAspectRatio(t *testing.T) {
 		})
 	}
 }
+
+func Test_aspectRatioWithin(t *testing.T) {
+	tests := []struct {
+		width     int
+		height    int
+		x         float64
+		y         float64
+		tolerance float64
+		want      bool
+	}{
+		{0, 0, 16, 9, 2, false},
+		{1920, 1080, 16, 9, 0, true},
+		{1921, 1080, 16, 9, 2, true},
+		{1921, 1080, 16, 9, 0, false},
+		{2000, 1080, 16, 9, 2, false},
+		{2000, 1080, 16, 9, 5, true},
+		{1080, 1920, 16, 9, 50, false},
+		{640, 480, 4, 3, 0.1, true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.width)+":"+strconv.Itoa(tt.height), func(t *testing.T) {
+			if got := aspectRatioWithin(tt.width, tt.height, tt.x, tt.y, tt.tolerance); got != tt.want {
+				t.Errorf("aspectRatioWithin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package validators
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// HeaderSize is the number of bytes from the start of the content that are always held in memory.
+const HeaderSize = 4096
+
+// Content is used to define the content that is being validated. The first HeaderSize bytes are held
+// in memory, and the remainder is only spooled to a temporary file as validators read past the header.
+// This means format checks that only need the header never touch the disk, and the content is never
+// held in memory in full.
+type Content struct {
+	// Partition, Path and ContentType describe the upload for validators that need them. Context is the
+	// context of the upload, which validators that make requests should use, and Logger is the logger of
+	// the upload. They can be nil.
+	Partition   string
+	Path        string
+	ContentType string
+	Context     context.Context
+	Logger      *slog.Logger
+
+	header  []byte
+	size    int64
+	src     io.Reader
+	spool   *os.File
+	spooled int64
+	err     error
+}
+
+// Gets the logger of the upload, or the default logger if it is not set.
+func (c *Content) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+// NewContent is used to create the content from a reader of the specified size. This reads the header
+// from the reader.
+func NewContent(r io.Reader, size int64) (*Content, error) {
+	n := int64(HeaderSize)
+	if size >= 0 && size < n {
+		n = size
+	}
+	header := make([]byte, n)
+	read, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return &Content{header: header[:read], size: size, src: r}, nil
+}
+
+// Header is used to get up to the first HeaderSize bytes of the content.
+func (c *Content) Header() []byte {
+	return c.header
+}
+
+// Size is used to get the size of the content as declared by the uploader.
+func (c *Content) Size() int64 {
+	return c.size
+}
+
+// Err is used to get the first error that happened reading the underlying reader past the header.
+func (c *Content) Err() error {
+	return c.err
+}
+
+// Open is used to get a reader from the start of the content. Anything read past the header is tee'd
+// into a temporary file so that further readers and the final upload can replay it.
+func (c *Content) Open() io.Reader {
+	return io.MultiReader(bytes.NewReader(c.header), &spoolReader{c: c})
+}
+
+// Spool is used to spool all of the content to disk for validators that need random access to it. This
+// returns the size that was actually read, since the uploader may have sent less than was declared.
+func (c *Content) Spool() (io.ReaderAt, int64, error) {
+	if _, err := io.Copy(io.Discard, &spoolReader{c: c, off: c.spooled}); err != nil {
+		return nil, 0, err
+	}
+	return contentReaderAt{c}, int64(len(c.header)) + c.spooled, nil
+}
+
+// Reader is used to get the reader that should be uploaded once validation is complete. Bytes that were
+// spooled are replayed from disk and the rest is read directly from the underlying reader, so the
+// content is never copied twice.
+func (c *Content) Reader() io.Reader {
+	readers := []io.Reader{bytes.NewReader(c.header)}
+	if c.spool != nil {
+		readers = append(readers, io.NewSectionReader(c.spool, 0, c.spooled))
+	}
+	return io.MultiReader(append(readers, c.src)...)
+}
+
+// Close is used to remove the temporary file if one was created.
+func (c *Content) Close() error {
+	if c.spool == nil {
+		return nil
+	}
+	_ = c.spool.Close()
+	return os.Remove(c.spool.Name())
+}
+
+// Defines a reader over the part of the content after the header.
+type spoolReader struct {
+	c   *Content
+	off int64
+}
+
+// Read is used to read from the spool if the bytes were already read, or the underlying reader if not.
+func (r *spoolReader) Read(p []byte) (int, error) {
+	c := r.c
+	if r.off < c.spooled {
+		if rem := c.spooled - r.off; int64(len(p)) > rem {
+			p = p[:rem]
+		}
+		n, err := c.spool.ReadAt(p, r.off)
+		r.off += int64(n)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	// Read from the underlying reader and tee it into the spool.
+	n, err := c.src.Read(p)
+	if n > 0 {
+		if c.spool == nil {
+			c.spool, c.err = os.CreateTemp("", "contenttruck-*")
+			if c.err != nil {
+				return 0, c.err
+			}
+		}
+		if _, c.err = c.spool.WriteAt(p[:n], c.spooled); c.err != nil {
+			return 0, c.err
+		}
+		c.spooled += int64(n)
+		r.off += int64(n)
+	}
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+// Defines random access over the header and the spool.
+type contentReaderAt struct {
+	c *Content
+}
+
+// ReadAt is used to read from the header and then the spool.
+func (r contentReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c := r.c
+	n := 0
+	if off < int64(len(c.header)) {
+		n = copy(p, c.header[off:])
+	}
+	if n < len(p) && c.spool != nil {
+		spoolOff := off + int64(n) - int64(len(c.header))
+		if rem := c.spooled - spoolOff; rem < int64(len(p)-n) {
+			if rem <= 0 {
+				return n, io.EOF
+			}
+			m, err := c.spool.ReadAt(p[n:n+int(rem)], spoolOff)
+			n += m
+			if err == nil {
+				err = io.EOF
+			}
+			return n, err
+		}
+		m, err := c.spool.ReadAt(p[n:], spoolOff)
+		return n + m, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package validators
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestContent(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		read int
+	}{
+		{"header only", 100, 0},
+		{"header read", HeaderSize * 2, HeaderSize},
+		{"partially spooled", HeaderSize * 3, HeaderSize + 10},
+		{"fully spooled", HeaderSize * 3, HeaderSize * 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := make([]byte, tt.size)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			c, err := NewContent(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			// Read part of the content twice to make sure the spool replays.
+			for i := 0; i < 2; i++ {
+				got, err := io.ReadAll(io.LimitReader(c.Open(), int64(tt.read)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, b[:tt.read]) {
+					t.Fatalf("Open() read mismatch on pass %d", i)
+				}
+			}
+
+			// Make sure the final reader has all the content.
+			got, err := io.ReadAll(c.Reader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, b) {
+				t.Errorf("Reader() returned %d bytes, want %d", len(got), len(b))
+			}
+		})
+	}
+}
+
+// Validates the data with the validator and the rule.
+func validateData(t *testing.T, v Validator, rule string, data []byte) error {
+	t.Helper()
+	c, err := NewContent(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	return v.Validate(c, rule)
+}
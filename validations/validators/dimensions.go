@@ -0,0 +1,99 @@
+package validators
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+type dimensionsValidator struct{}
+
+var _ Validator = (*dimensionsValidator)(nil)
+
+var dimensionsRegex = regexp.MustCompile(`^(min-width|max-width|min-height|max-height|max-pixels)=(\d+)$`)
+
+// Matches is used to check if a validator matches a string.
+func (p *dimensionsValidator) Matches(s string) bool {
+	m := dimensionsRegex.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	_, err := strconv.ParseUint(m[2], 10, 64)
+	return err == nil
+}
+
+// Gets the image config from the content. This only reads as far as the image header, so the pixels
+// are never decoded.
+func imageConfig(c *Content) (image.Config, error) {
+	conf, _, err := image.DecodeConfig(c.Open())
+	if err != nil {
+		return image.Config{}, errors.New("The image specified is not a valid image")
+	}
+	return conf, nil
+}
+
+// Defines the most pixels an image can have to be decoded, since decoding allocates all of them.
+const maxDecodePixels = 50 * 1000 * 1000
+
+var errImageTooLarge = errors.New("The image specified has too many pixels to be decoded")
+
+// Decodes an image to check it is valid, but only after checking from its header that it is not too large
+// to decode, so small images with huge dimensions cannot use up the memory. notValid is returned if the
+// image is not valid.
+func decodeImage(c *Content, decodeConfig func(io.Reader) (image.Config, error),
+	decode func(io.Reader) (image.Image, error), notValid error) error {
+	conf, err := decodeConfig(c.Open())
+	if err != nil {
+		return notValid
+	}
+	if uint64(conf.Width)*uint64(conf.Height) > maxDecodePixels {
+		return errImageTooLarge
+	}
+	if _, err = decode(c.Open()); err != nil {
+		return notValid
+	}
+	return nil
+}
+
+// Validate is used to validate the content is an image within the dimensions specified.
+func (p *dimensionsValidator) Validate(c *Content, s string) error {
+	m := dimensionsRegex.FindStringSubmatch(s)
+	limit, _ := strconv.ParseUint(m[2], 10, 64)
+	conf, err := imageConfig(c)
+	if err != nil {
+		return err
+	}
+	width, height := uint64(conf.Width), uint64(conf.Height)
+
+	// Check the dimension against the limit.
+	switch m[1] {
+	case "min-width":
+		if width < limit {
+			return fmt.Errorf("The image specified is narrower than %d pixels", limit)
+		}
+	case "max-width":
+		if width > limit {
+			return fmt.Errorf("The image specified is wider than %d pixels", limit)
+		}
+	case "min-height":
+		if height < limit {
+			return fmt.Errorf("The image specified is shorter than %d pixels", limit)
+		}
+	case "max-height":
+		if height > limit {
+			return fmt.Errorf("The image specified is taller than %d pixels", limit)
+		}
+	case "max-pixels":
+		if width*height > limit {
+			return fmt.Errorf("The image specified has more than %d pixels", limit)
+		}
+	}
+	return nil
+}
+
+func init() {
+	Validators = append(Validators, &dimensionsValidator{})
+}
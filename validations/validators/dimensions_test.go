@@ -0,0 +1,80 @@
+package validators
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func Test_dimensionsValidator_Matches(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"min-width=100", true},
+		{"max-width=100", true},
+		{"min-height=0", true},
+		{"max-height=100", true},
+		{"max-pixels=25000000", true},
+		{"max-pixels=18446744073709551615", true},
+		{"max-pixels=18446744073709551616", false},
+		{"max-width=-1", false},
+		{"max-width=", false},
+		{"max-width=1.5", false},
+		{"max-depth=100", false},
+		{"max-width=100 ", false},
+		{"png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := (&dimensionsValidator{}).Matches(tt.s); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Encodes a png of the width and height.
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_dimensionsValidator_Validate(t *testing.T) {
+	wide := testPNG(t, 200, 100)
+	huge := testPNGHeader(100000, 100000)
+	tests := []struct {
+		name  string
+		rule  string
+		data  []byte
+		valid bool
+	}{
+		{"min width", "min-width=200", wide, true},
+		{"below min width", "min-width=201", wide, false},
+		{"max width", "max-width=200", wide, true},
+		{"above max width", "max-width=199", wide, false},
+		{"min height", "min-height=100", wide, true},
+		{"below min height", "min-height=101", wide, false},
+		{"max height", "max-height=100", wide, true},
+		{"above max height", "max-height=99", wide, false},
+		{"max pixels", "max-pixels=20000", wide, true},
+		{"above max pixels", "max-pixels=19999", wide, false},
+		{"huge header only", "max-pixels=25000000", huge, false},
+		{"huge header within bound", "max-width=100000", huge, true},
+		{"not an image", "max-width=100", []byte("hello world"), false},
+		{"empty", "max-width=100", []byte{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &dimensionsValidator{}, tt.rule, tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package validators
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+type maxDurationValidator struct{}
+
+var _ Validator = (*maxDurationValidator)(nil)
+
+var maxDurationRegex = regexp.MustCompile(`^max-duration=(.+)$`)
+
+// Matches is used to check if a validator matches a string.
+func (p *maxDurationValidator) Matches(s string) bool {
+	m := maxDurationRegex.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	d, err := time.ParseDuration(m[1])
+	return err == nil && d > 0
+}
+
+// Validate is used to validate the content is a video or audio file that is at most the duration
+// specified. This supports mp4, webm and wav.
+func (p *maxDurationValidator) Validate(c *Content, s string) error {
+	limit, _ := time.ParseDuration(maxDurationRegex.FindStringSubmatch(s)[1])
+
+	// Get the duration based on the format.
+	var (
+		duration time.Duration
+		err      error
+	)
+	h := c.Header()
+	switch {
+	case isMP4(h):
+		ra, size, e := c.Spool()
+		if e != nil {
+			return e
+		}
+		duration, err = mp4Duration(ra, size)
+	case len(h) >= 4 && binary.BigEndian.Uint32(h) == ebmlIDHeader:
+		ra, size, e := c.Spool()
+		if e != nil {
+			return e
+		}
+		duration, err = webmDuration(ra, size)
+		if err == nil && duration < 0 {
+			return errors.New("The webm specified does not have a duration")
+		}
+	case len(h) >= 12 && string(h[:4]) == "RIFF" && string(h[8:12]) == "WAVE":
+		duration, err = wavDuration(c.Open(), c.Size())
+	default:
+		return errors.New("The file specified is not a mp4, webm or wav")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check the duration.
+	if duration > limit {
+		return fmt.Errorf("The file specified is longer than %s", limit)
+	}
+	return nil
+}
+
+func init() {
+	Validators = append(Validators, &maxDurationValidator{})
+}
@@ -0,0 +1,44 @@
+package validators
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func Test_maxDurationValidator(t *testing.T) {
+	hostileMP4 := testMP4(10000)
+	binary.BigEndian.PutUint32(hostileMP4[24:28], 0x7fffffff)
+	hostileWAV := testWAV(16000)
+	binary.LittleEndian.PutUint32(hostileWAV[40:44], 0xffffffff)
+	heic := append(testFtyp("heic", "mif1", "heic", "iso8"), testBox("meta", make([]byte, 8))...)
+	tests := []struct {
+		name  string
+		data  []byte
+		rule  string
+		valid bool
+	}{
+		{"mp4 under", testMP4(9999), "max-duration=10s", true},
+		{"mp4 at", testMP4(10000), "max-duration=10s", true},
+		{"mp4 over", testMP4(10001), "max-duration=10s", false},
+		{"webm at", testWebM(10000), "max-duration=10s", true},
+		{"webm over", testWebM(10001), "max-duration=10s", false},
+		{"webm without duration", append(testEBML(ebmlIDHeader, testEBML(ebmlIDDocType, []byte("webm"))),
+			testEBML(ebmlIDSegment, testEBML(ebmlIDInfo))...), "max-duration=10s", false},
+		{"wav at", testWAV(16000), "max-duration=1s", true},
+		{"wav over", testWAV(16002), "max-duration=1s", false},
+		{"heic", heic, "max-duration=10s", false},
+		{"gif", testGIF(1), "max-duration=10s", false},
+		{"truncated mp4", testMP4(1000)[:40], "max-duration=10s", false},
+		{"truncated wav", testWAV(1000)[:40], "max-duration=10s", false},
+		{"hostile mp4", hostileMP4, "max-duration=10s", false},
+		{"hostile wav", hostileWAV, "max-duration=10s", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &maxDurationValidator{}, tt.rule, tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package validators
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+type maxFramesValidator struct{}
+
+var _ Validator = (*maxFramesValidator)(nil)
+
+var maxFramesRegex = regexp.MustCompile(`^max-frames=(\d+)$`)
+
+// Matches is used to check if a validator matches a string.
+func (p *maxFramesValidator) Matches(s string) bool {
+	m := maxFramesRegex.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	_, err := strconv.Atoi(m[1])
+	return err == nil
+}
+
+// Validate is used to validate the content is an animated image with at most the number of frames
+// specified. This supports gif and webp.
+func (p *maxFramesValidator) Validate(c *Content, s string) error {
+	limit, _ := strconv.Atoi(maxFramesRegex.FindStringSubmatch(s)[1])
+
+	// Count the frames based on the format.
+	var (
+		frames int
+		err    error
+	)
+	h := c.Header()
+	switch {
+	case bytes.HasPrefix(h, []byte("GIF8")):
+		frames, err = gifFrames(c.Open())
+	case len(h) >= 12 && string(h[:4]) == "RIFF" && string(h[8:12]) == "WEBP":
+		ra, size, e := c.Spool()
+		if e != nil {
+			return e
+		}
+		frames, err = webpFrames(ra, size)
+	default:
+		return errors.New("The image specified is not a gif or webp")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check the frame count.
+	if frames > limit {
+		return fmt.Errorf("The image specified has more than %d frames", limit)
+	}
+	return nil
+}
+
+func init() {
+	Validators = append(Validators, &maxFramesValidator{})
+}
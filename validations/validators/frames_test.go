@@ -0,0 +1,39 @@
+package validators
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func Test_maxFramesValidator(t *testing.T) {
+	gif := testGIF(3)
+	hostileWebP := testWebP(3)
+	binary.LittleEndian.PutUint32(hostileWebP[16:20], 0xffffffff)
+	tests := []struct {
+		name  string
+		data  []byte
+		rule  string
+		valid bool
+	}{
+		{"gif under", testGIF(2), "max-frames=3", true},
+		{"gif at", gif, "max-frames=3", true},
+		{"gif over", testGIF(4), "max-frames=3", false},
+		{"still gif", testGIF(1), "max-frames=1", true},
+		{"still gif with no frames allowed", testGIF(1), "max-frames=0", false},
+		{"webp at", testWebP(3), "max-frames=3", true},
+		{"webp over", testWebP(4), "max-frames=3", false},
+		{"still webp", testWebP(1), "max-frames=1", true},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), "max-frames=3", false},
+		{"truncated gif", gif[:len(gif)-1], "max-frames=3", false},
+		{"truncated webp", testWebP(3)[:30], "max-frames=3", false},
+		{"hostile webp", hostileWebP, "max-frames=3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &maxFramesValidator{}, tt.rule, tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
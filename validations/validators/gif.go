@@ -0,0 +1,106 @@
+package validators
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+type gifValidator struct{}
+
+var _ Validator = (*gifValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *gifValidator) Matches(s string) bool {
+	return s == "gif"
+}
+
+var errNotGIF = errors.New("The image specified is not a gif")
+
+// Walks the blocks of a gif without decoding the frames, and returns the number of frames.
+func gifFrames(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	var buf [13]byte
+
+	// Read the header and logical screen descriptor.
+	if _, err := io.ReadFull(br, buf[:13]); err != nil {
+		return 0, errNotGIF
+	}
+	if s := string(buf[:6]); s != "GIF87a" && s != "GIF89a" {
+		return 0, errNotGIF
+	}
+	if buf[10]&0x80 != 0 {
+		if _, err := br.Discard(3 << ((buf[10] & 0x07) + 1)); err != nil {
+			return 0, errNotGIF
+		}
+	}
+
+	// Skips data sub-blocks until the block terminator.
+	skipSubBlocks := func() error {
+		for {
+			n, err := br.ReadByte()
+			if err != nil {
+				return errNotGIF
+			}
+			if n == 0 {
+				return nil
+			}
+			if _, err = br.Discard(int(n)); err != nil {
+				return errNotGIF
+			}
+		}
+	}
+
+	frames := 0
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, errNotGIF
+		}
+		switch b {
+		case 0x21:
+			// Extension. Skip the label and the data.
+			if _, err = br.ReadByte(); err != nil {
+				return 0, errNotGIF
+			}
+			if err = skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C:
+			// Image descriptor, an optional local color table, and the LZW data.
+			if _, err = io.ReadFull(br, buf[:9]); err != nil {
+				return 0, errNotGIF
+			}
+			if buf[8]&0x80 != 0 {
+				if _, err = br.Discard(3 << ((buf[8] & 0x07) + 1)); err != nil {
+					return 0, errNotGIF
+				}
+			}
+			if _, err = br.ReadByte(); err != nil {
+				return 0, errNotGIF
+			}
+			if err = skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B:
+			// Trailer.
+			if frames == 0 {
+				return 0, errNotGIF
+			}
+			return frames, nil
+		default:
+			return 0, errNotGIF
+		}
+	}
+}
+
+// Validate is used to validate the content is a gif.
+func (p *gifValidator) Validate(c *Content, _ string) error {
+	_, err := gifFrames(c.Open())
+	return err
+}
+
+func init() {
+	Validators = append(Validators, &gifValidator{})
+}
@@ -0,0 +1,44 @@
+package validators
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Builds a gif with the number of frames and no color tables.
+func testGIF(frames int) []byte {
+	b := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00")
+	for i := 0; i < frames; i++ {
+		b = append(b, "\x21\xf9\x04\x00\x00\x00\x00\x00"...)
+		b = append(b, "\x2c\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02\x4c\x01\x00"...)
+	}
+	return append(b, 0x3b)
+}
+
+func Test_gifFrames(t *testing.T) {
+	valid := testGIF(3)
+	still := testGIF(1)
+	tests := []struct {
+		name   string
+		data   []byte
+		frames int
+	}{
+		{"still", still, 1},
+		{"animated", valid, 3},
+		{"no frames", testGIF(0), 0},
+		{"truncated", valid[:len(valid)-1], 0},
+		{"truncated header", valid[:8], 0},
+		{"not gif", []byte("GIF90a\x01\x00\x01\x00\x00\x00\x00\x3b"), 0},
+		{"missing color table", []byte("GIF89a\x01\x00\x01\x00\x87\x00\x00\x3b"), 0},
+		{"hostile sub-block length", append(still[:len(still)-5:len(still)-5], 0xff, 0x01, 0x02), 0},
+		{"unknown block", append(still[:len(still)-1:len(still)-1], 0x00), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := gifFrames(bytes.NewReader(tt.data))
+			if (err != nil) != (tt.frames == 0) || frames != tt.frames {
+				t.Errorf("gifFrames() = %v, %v, want %v", frames, err, tt.frames)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package validators
+
+import (
+	"errors"
+)
+
+type heifValidator struct{}
+
+var _ Validator = (*heifValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *heifValidator) Matches(s string) bool {
+	return s == "avif" || s == "heic"
+}
+
+// Validate is used to validate the content is an AVIF or HEIC image. This only sniffs the container
+// brands from the header.
+func (p *heifValidator) Validate(c *Content, s string) error {
+	brands := isoBrands(c.Header())
+	if s == "avif" {
+		if !hasBrand(brands, "avif", "avis") {
+			return errors.New("The image specified is not an avif")
+		}
+		return nil
+	}
+	if !hasBrand(brands, "heic", "heix", "heim", "heis", "hevc", "hevx") {
+		return errors.New("The image specified is not a heic")
+	}
+	return nil
+}
+
+func init() {
+	Validators = append(Validators, &heifValidator{})
+}
@@ -0,0 +1,35 @@
+package validators
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func Test_heifValidator(t *testing.T) {
+	avif := append(testFtyp("avif", "avif", "mif1", "miaf"), testBox("meta", make([]byte, 8))...)
+	heic := append(testFtyp("heic", "mif1", "heic"), testBox("meta", make([]byte, 8))...)
+	hostile := append([]byte(nil), heic...)
+	binary.BigEndian.PutUint32(hostile, 0xffffffff)
+	tests := []struct {
+		name  string
+		data  []byte
+		rule  string
+		valid bool
+	}{
+		{"avif", avif, "avif", true},
+		{"heic", heic, "heic", true},
+		{"heic as avif", heic, "avif", false},
+		{"avif as heic", avif, "heic", false},
+		{"mp4", testMP4(1000), "heic", false},
+		{"truncated", heic[:20], "heic", false},
+		{"hostile ftyp size", hostile, "heic", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &heifValidator{}, tt.rule, tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package validators
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Hook is used to define an external HTTP endpoint that accepts or rejects uploads.
+type Hook struct {
+	URL         string
+	Secret      string
+	Timeout     time.Duration
+	IncludeBody bool
+	FailOpen    bool
+}
+
+type hookValidator struct {
+	client *http.Client
+	hooks  map[string]*Hook
+}
+
+// NewHookValidator is used to create the validator for the hooks, which can be used with "hook=<name>". The
+// hooks are copied, so changing them afterwards has no effect.
+func NewHookValidator(hooks map[string]*Hook) Validator {
+	v := &hookValidator{client: &http.Client{}, hooks: make(map[string]*Hook, len(hooks))}
+	for name, hook := range hooks {
+		h := *hook
+		v.hooks[name] = &h
+	}
+	return v
+}
+
+var _ Validator = (*hookValidator)(nil)
+
+var hookRegex = regexp.MustCompile(`^hook=([A-Za-z0-9_-]+)$`)
+
+// Matches is used to check if a validator matches a string.
+func (p *hookValidator) Matches(s string) bool {
+	m := hookRegex.FindStringSubmatch(s)
+	return m != nil && p.hooks[m[1]] != nil
+}
+
+// Defines the metadata that is sent to the hook.
+type hookMetadata struct {
+	Hook        string `json:"hook"`
+	Partition   string `json:"partition"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+// Defines the response from the hook.
+type hookResponse struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// Calls the hook and returns if it allowed the upload.
+func (p *hookValidator) call(c *Content, name string, hook *Hook) (*hookResponse, error) {
+	meta := hookMetadata{
+		Hook:        name,
+		Partition:   c.Partition,
+		Path:        c.Path,
+		ContentType: c.ContentType,
+		Size:        c.Size(),
+	}
+
+	// If the body is included, the hash goes in the metadata so that the signature covers it.
+	if hook.IncludeBody {
+		h := sha256.New()
+		if _, err := io.Copy(h, c.Open()); err != nil {
+			return nil, err
+		}
+		meta.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign the timestamp and the metadata.
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	_, _ = mac.Write([]byte(timestamp + "." + string(metaJSON)))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	// Build the request. It is cancelled if the upload is.
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if hook.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+	var req *http.Request
+	if hook.IncludeBody {
+		req, err = http.NewRequestWithContext(ctx, "POST", hook.URL, c.Open())
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = c.Size()
+		req.Header.Set("Content-Type", c.ContentType)
+		req.Header.Set("X-Contenttruck-Metadata", string(metaJSON))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(metaJSON))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Contenttruck-Timestamp", timestamp)
+	req.Header.Set("X-Contenttruck-Signature", signature)
+
+	// Do the request and decode the response.
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+	var hookResp hookResponse
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&hookResp); err != nil {
+		return nil, err
+	}
+	return &hookResp, nil
+}
+
+// Validate is used to validate the content is allowed by the hook.
+func (p *hookValidator) Validate(c *Content, s string) error {
+	name := hookRegex.FindStringSubmatch(s)[1]
+	hook := p.hooks[name]
+	resp, err := p.call(c, name, hook)
+	if err != nil {
+		c.logger().Error("Error calling validation hook", "err", err, "hook", name)
+		if hook.FailOpen {
+			return nil
+		}
+		return errors.New("The file could not be checked by the validation hook")
+	}
+	if !resp.Allow {
+		if resp.Reason == "" {
+			return errors.New("The file was rejected by the validation hook")
+		}
+		return errors.New("The file was rejected by the validation hook: " + resp.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package validators
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_hookValidator(t *testing.T) {
+	// Start a hook which rejects anything with "bad" in the path, and checks the signature and body.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta := r.Header.Get("X-Contenttruck-Metadata")
+		if meta == "" {
+			b, _ := io.ReadAll(r.Body)
+			meta = string(b)
+		} else {
+			b, _ := io.ReadAll(r.Body)
+			sum := sha256.Sum256(b)
+			if !strings.Contains(meta, hex.EncodeToString(sum[:])) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		mac := hmac.New(sha256.New, []byte("secret"))
+		_, _ = mac.Write([]byte(r.Header.Get("X-Contenttruck-Timestamp") + "." + meta))
+		if r.Header.Get("X-Contenttruck-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var m hookMetadata
+		_ = json.Unmarshal([]byte(meta), &m)
+		_ = json.NewEncoder(w).Encode(hookResponse{Allow: !strings.Contains(m.Path, "bad"), Reason: "bad path"})
+	}))
+	defer srv.Close()
+
+	v := NewHookValidator(map[string]*Hook{
+		"meta":      {URL: srv.URL, Secret: "secret", Timeout: time.Second},
+		"body":      {URL: srv.URL, Secret: "secret", Timeout: time.Second, IncludeBody: true},
+		"down":      {URL: "http://127.0.0.1:1", Timeout: time.Second},
+		"down-open": {URL: "http://127.0.0.1:1", Timeout: time.Second, FailOpen: true},
+	})
+
+	tests := []struct {
+		hook  string
+		path  string
+		valid bool
+	}{
+		{"meta", "a/good.png", true},
+		{"meta", "a/bad.png", false},
+		{"body", "a/good.png", true},
+		{"body", "a/bad.png", false},
+		{"down", "a/good.png", false},
+		{"down-open", "a/good.png", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hook+" "+tt.path, func(t *testing.T) {
+			const body = "hello world"
+			c, err := NewContent(strings.NewReader(body), int64(len(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			c.Path = tt.path
+			if !v.Matches("hook=" + tt.hook) {
+				t.Fatal("Matches() returned false")
+			}
+			err = v.Validate(c, "hook="+tt.hook)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+	if v.Matches("hook=missing") {
+		t.Error("Matches() returned true for a missing hook")
+	}
+}
+
+func Test_hookValidatorCancelled(t *testing.T) {
+	// Start a hook which never responds until the test ends.
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	v := NewHookValidator(map[string]*Hook{"slow": {URL: srv.URL, Secret: "secret"}})
+	const body = "hello world"
+	c, err := NewContent(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Context = ctx
+	if err = v.Validate(c, "hook=slow"); err == nil {
+		t.Error("Validate() returned no error for a cancelled upload")
+	}
+}
+
+func Test_hookValidatorLogger(t *testing.T) {
+	v := NewHookValidator(map[string]*Hook{"down": {URL: "http://127.0.0.1:1", Timeout: time.Second}})
+	const body = "hello world"
+	c, err := NewContent(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	buf := &bytes.Buffer{}
+	c.Logger = slog.New(slog.NewTextHandler(buf, nil)).With("request_id", "abc")
+	if err = v.Validate(c, "hook=down"); err == nil {
+		t.Fatal("Validate() returned no error for a hook that is down")
+	}
+	if !strings.Contains(buf.String(), "request_id=abc") {
+		t.Errorf("hook error was not logged with the upload logger: %q", buf.String())
+	}
+}
@@ -5,8 +5,9 @@ type Validator interface {
 	// Matches is used to check if a validator matches a string.
 	Matches(s string) bool
 
-	// Validate is used to validate a byte slice.
-	Validate(b []byte, _ string) error
+	// Validate is used to validate the content. Validators that only need to check the format should
+	// use the header where possible, since opening the content spools it to disk.
+	Validate(c *Content, s string) error
 }
 
 // Validators is used to define a list of validators in this package.
@@ -0,0 +1,105 @@
+package validators
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Defines a box in an ISO base media file (the container used by MP4, AVIF and HEIC).
+type isoBox struct {
+	typ       string
+	off       int64
+	headerLen int64
+	size      int64
+}
+
+var errTruncatedBox = errors.New("box extends past the end of the file")
+
+// Walks the boxes between start and end, calling the function for each box. Returning false from the
+// function stops the walk.
+func walkISOBoxes(ra io.ReaderAt, start, end int64, fn func(b isoBox) (bool, error)) error {
+	var hdr [16]byte
+	for off := start; off < end; {
+		if end-off < 8 {
+			return errTruncatedBox
+		}
+		if _, err := ra.ReadAt(hdr[:8], off); err != nil {
+			return err
+		}
+		b := isoBox{
+			typ:       string(hdr[4:8]),
+			off:       off,
+			headerLen: 8,
+			size:      int64(binary.BigEndian.Uint32(hdr[:4])),
+		}
+		switch b.size {
+		case 0:
+			// The box extends to the end of the file.
+			b.size = end - off
+		case 1:
+			// The size is a 64-bit integer after the type.
+			if end-off < 16 {
+				return errTruncatedBox
+			}
+			if _, err := ra.ReadAt(hdr[8:16], off+8); err != nil {
+				return err
+			}
+			b.headerLen = 16
+			b.size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		}
+		if b.size < b.headerLen || b.size > end-off {
+			return errTruncatedBox
+		}
+		cont, err := fn(b)
+		if err != nil || !cont {
+			return err
+		}
+		off += b.size
+	}
+	return nil
+}
+
+// Defines the brands of ISO files that are videos or audio, and of ones that are images. Images can also
+// list some of the generic brands, so the image brands are checked too.
+var (
+	mp4Brands = []string{
+		"isom", "iso2", "iso3", "iso4", "iso5", "iso6", "iso7", "iso8", "iso9", "mp41", "mp42", "mp71", "avc1",
+		"dash", "M4V ", "M4A ", "M4B ", "M4P ", "f4v ", "3gp4", "3gp5", "3gp6", "3g2a", "qt  ", "mmp4", "MSNV",
+	}
+	imageBrands = []string{"avif", "avis", "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"}
+)
+
+// Checks if the header is of an ISO file that is a video or audio rather than an image.
+func isMP4(header []byte) bool {
+	brands := isoBrands(header)
+	return hasBrand(brands, mp4Brands...) && !hasBrand(brands, imageBrands...)
+}
+
+// Gets the brands from the ftyp box at the start of the header. Returns nil if there is no ftyp box.
+func isoBrands(header []byte) []string {
+	if len(header) < 16 || string(header[4:8]) != "ftyp" {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(header[:4]))
+	if size < 16 || size > len(header) {
+		return nil
+	}
+	brands := []string{string(header[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(header[i:i+4]))
+	}
+	return brands
+}
+
+// Checks if any of the brands are in the list.
+func hasBrand(brands []string, want ...string) bool {
+	for _, b := range brands {
+		for _, w := range want {
+			if b == w {
+				return true
+			}
+		}
+	}
+	return false
+}
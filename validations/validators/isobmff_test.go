@@ -0,0 +1,87 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// Builds an ISO box.
+func testBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(body)+8))
+	return append(append(b, typ...), body...)
+}
+
+// Builds a ftyp box with the major brand and the compatible brands.
+func testFtyp(major string, compatible ...string) []byte {
+	b := append([]byte(major), 0, 0, 0, 0)
+	for _, v := range compatible {
+		b = append(b, v...)
+	}
+	return testBox("ftyp", b)
+}
+
+func Test_walkISOBoxes(t *testing.T) {
+	valid := append(testFtyp("isom", "isom"), testBox("free", make([]byte, 4))...)
+	large := append([]byte("\x00\x00\x00\x01free\x00\x00\x00\x00\x00\x00\x00\x14"), make([]byte, 4)...)
+	tests := []struct {
+		name    string
+		data    []byte
+		types   []string
+		wantErr bool
+	}{
+		{"boxes", valid, []string{"ftyp", "free"}, false},
+		{"to end", append(testFtyp("isom"), "\x00\x00\x00\x00mdat\x01\x02"...), []string{"ftyp", "mdat"}, false},
+		{"64-bit size", large, []string{"free"}, false},
+		{"truncated", valid[:len(valid)-1], []string{"ftyp"}, true},
+		{"truncated header", valid[:len(valid)-10], []string{"ftyp"}, true},
+		{"truncated 64-bit size", large[:12], nil, true},
+		{"hostile size", []byte("\x00\x00\x00\x04free"), nil, true},
+		{"hostile 64-bit size", []byte("\x00\x00\x00\x01free\x80\x00\x00\x00\x00\x00\x00\x00"), nil, true},
+		{"size past end", []byte("\xff\xff\xff\xfffree"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var types []string
+			err := walkISOBoxes(bytes.NewReader(tt.data), 0, int64(len(tt.data)), func(b isoBox) (bool, error) {
+				types = append(types, b.typ)
+				return true, nil
+			})
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(types, tt.types) {
+				t.Errorf("walkISOBoxes() = %v, %v, want %v, error %v", types, err, tt.types, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_isoBrands(t *testing.T) {
+	hostile := testFtyp("isom", "isom")
+	binary.BigEndian.PutUint32(hostile, 0xffffffff)
+	tests := []struct {
+		name   string
+		header []byte
+		brands []string
+		mp4    bool
+	}{
+		{"mp4", testFtyp("isom", "isom", "iso2"), []string{"isom", "isom", "iso2"}, true},
+		{"quicktime", testFtyp("qt  ", "qt  "), []string{"qt  ", "qt  "}, true},
+		{"avif", testFtyp("avif", "avif", "mif1", "miaf"), []string{"avif", "avif", "mif1", "miaf"}, false},
+		{"heic listing iso8", testFtyp("heic", "mif1", "heic", "iso8"), []string{"heic", "mif1", "heic", "iso8"}, false},
+		{"unknown brand", testFtyp("abcd", "abcd"), []string{"abcd", "abcd"}, false},
+		{"not ftyp", testBox("free", make([]byte, 8)), nil, false},
+		{"truncated", testFtyp("isom", "isom")[:19], nil, false},
+		{"hostile size", hostile, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isoBrands(tt.header); !reflect.DeepEqual(got, tt.brands) {
+				t.Errorf("isoBrands() = %v, want %v", got, tt.brands)
+			}
+			if got := isMP4(tt.header); got != tt.mp4 {
+				t.Errorf("isMP4() = %v, want %v", got, tt.mp4)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package validators
 import (
 	"errors"
 	"image/jpeg"
-	"strings"
 )
 
 type jpegValidator struct{}
@@ -15,13 +14,11 @@ func (p *jpegValidator) Matches(s string) bool {
 	return s == "jpeg" || s == "jpg"
 }
 
-// Validate is used to validate a byte slice is a jpeg.
-func (p *jpegValidator) Validate(b []byte, _ string) error {
-	_, err := jpeg.Decode(strings.NewReader(string(b)))
-	if err != nil {
-		return errors.New("The image specified is not a jpeg")
-	}
-	return nil
+var errNotJPEG = errors.New("The image specified is not a jpeg")
+
+// Validate is used to validate the content is a jpeg.
+func (p *jpegValidator) Validate(c *Content, _ string) error {
+	return decodeImage(c, jpeg.DecodeConfig, jpeg.Decode, errNotJPEG)
 }
 
 func init() {
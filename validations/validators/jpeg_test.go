@@ -0,0 +1,42 @@
+package validators
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// Sets the width and height in the start of frame of a jpeg.
+func setJPEGSize(b []byte, width, height uint16) []byte {
+	b = bytes.Clone(b)
+	i := bytes.Index(b, []byte{0xff, 0xc0})
+	b[i+5], b[i+6] = byte(height>>8), byte(height)
+	b[i+7], b[i+8] = byte(width>>8), byte(width)
+	return b
+}
+
+func Test_jpegValidator(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"truncated", valid[:len(valid)/2], errNotJPEG},
+		{"huge dimensions", setJPEGSize(valid, 65000, 65000), errImageTooLarge},
+		{"not jpeg", []byte("\x89PNG\r\n\x1a\n"), errNotJPEG},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateData(t, &jpegValidator{}, "jpeg", tt.data); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package validators
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+type mp3Validator struct{}
+
+var _ Validator = (*mp3Validator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *mp3Validator) Matches(s string) bool {
+	return s == "mp3"
+}
+
+var errNotMP3 = errors.New("The audio specified is not a mp3")
+
+// Defines the bitrates in kbps indexed by [MPEG-1][layer - 1][index].
+var mp3Bitrates = [2][3][15]int{
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+}
+
+// Defines the sample rates indexed by [version][index], where the version is from the header.
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},
+	{},
+	{22050, 24000, 16000},
+	{44100, 48000, 32000},
+}
+
+// Parses a MPEG audio frame header. Returns the frame length and a key identifying the stream the
+// frame belongs to, or 0 if the header is invalid.
+func parseMP3Header(h []byte) (length int, key byte) {
+	if h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return 0, 0
+	}
+	version := (h[1] >> 3) & 0x03
+	layer := 4 - int((h[1]>>1)&0x03)
+	bitrateIdx := h[2] >> 4
+	sampleRateIdx := (h[2] >> 2) & 0x03
+	padding := int((h[2] >> 1) & 0x01)
+	if version == 1 || layer == 4 || bitrateIdx == 0 || bitrateIdx == 15 || sampleRateIdx == 3 {
+		return 0, 0
+	}
+	mpeg1 := 0
+	if version == 3 {
+		mpeg1 = 1
+	}
+	bitrate := mp3Bitrates[mpeg1][layer-1][bitrateIdx] * 1000
+	sampleRate := mp3SampleRates[version][sampleRateIdx]
+
+	// Calculate the frame length based on the layer.
+	switch {
+	case layer == 1:
+		length = (12*bitrate/sampleRate + padding) * 4
+	case layer == 3 && mpeg1 == 0:
+		length = 72*bitrate/sampleRate + padding
+	default:
+		length = 144*bitrate/sampleRate + padding
+	}
+	return length, (h[1]>>1)&0x0F<<2 | sampleRateIdx
+}
+
+// Validate is used to validate the content is a mp3. This skips any ID3v2 tag and checks the first
+// few frames are consistent.
+func (p *mp3Validator) Validate(c *Content, _ string) error {
+	br := bufio.NewReader(c.Open())
+	var buf [10]byte
+	if _, err := io.ReadFull(br, buf[:4]); err != nil {
+		return errNotMP3
+	}
+
+	// Skip the ID3v2 tag if there is one. The size is a syncsafe integer.
+	if string(buf[:3]) == "ID3" {
+		if _, err := io.ReadFull(br, buf[4:10]); err != nil {
+			return errNotMP3
+		}
+		size := int(buf[6]&0x7F)<<21 | int(buf[7]&0x7F)<<14 | int(buf[8]&0x7F)<<7 | int(buf[9]&0x7F)
+		if buf[5]&0x10 != 0 {
+			// There is a footer.
+			size += 10
+		}
+		if _, err := br.Discard(size); err != nil {
+			return errNotMP3
+		}
+		if _, err := io.ReadFull(br, buf[:4]); err != nil {
+			return errNotMP3
+		}
+	}
+
+	// Check the first frame, and that the next few frames follow on from it.
+	length, key := parseMP3Header(buf[:4])
+	if length < 4 {
+		return errNotMP3
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := br.Discard(length - 4); err != nil {
+			return errNotMP3
+		}
+		n, err := io.ReadFull(br, buf[:4])
+		if n == 0 && err == io.EOF {
+			// The file ended on a frame boundary.
+			return nil
+		}
+		if n >= 3 && string(buf[:3]) == "TAG" {
+			// This is the ID3v1 tag at the end of the file.
+			return nil
+		}
+		if err != nil {
+			return errNotMP3
+		}
+		var nextKey byte
+		length, nextKey = parseMP3Header(buf[:4])
+		if length < 4 || nextKey != key {
+			return errNotMP3
+		}
+	}
+	return nil
+}
+
+func init() {
+	Validators = append(Validators, &mp3Validator{})
+}
@@ -0,0 +1,42 @@
+package validators
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Builds a mp3 with the number of 128kbps 44.1kHz MPEG-1 layer 3 frames, which are 417 bytes each.
+func testMP3(frames int) []byte {
+	frame := append([]byte("\xff\xfb\x90\x00"), make([]byte, 413)...)
+	return bytes.Repeat(frame, frames)
+}
+
+func Test_mp3Validator(t *testing.T) {
+	valid := testMP3(4)
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+	mixed := append(testMP3(1), "\xff\xfb\x94\x00"...)
+	mixed = append(mixed, make([]byte, 413)...)
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"frames", valid, true},
+		{"one frame", testMP3(1), true},
+		{"id3v2 tag", append(id3, valid...), true},
+		{"id3v1 tag", append(testMP3(2), "TAG"...), true},
+		{"not mp3", []byte("hello world"), false},
+		{"different sample rate", mixed, false},
+		{"truncated", valid[:600], false},
+		{"truncated header", valid[:3], false},
+		{"hostile id3v2 size", append([]byte("ID3\x04\x00\x00\x7f\x7f\x7f\x7f"), valid...), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &mp3Validator{}, "mp3", tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
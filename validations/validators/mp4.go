@@ -0,0 +1,87 @@
+package validators
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+type mp4Validator struct{}
+
+var _ Validator = (*mp4Validator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *mp4Validator) Matches(s string) bool {
+	return s == "mp4"
+}
+
+var errNotMP4 = errors.New("The video specified is not a mp4")
+
+// Gets the duration of a MP4 from the mvhd box inside the moov box.
+func mp4Duration(ra io.ReaderAt, size int64) (time.Duration, error) {
+	duration := time.Duration(-1)
+	err := walkISOBoxes(ra, 0, size, func(b isoBox) (bool, error) {
+		if b.off == 0 && b.typ != "ftyp" {
+			return false, errNotMP4
+		}
+		if b.typ != "moov" {
+			return true, nil
+		}
+		return false, walkISOBoxes(ra, b.off+b.headerLen, b.off+b.size, func(b isoBox) (bool, error) {
+			if b.typ != "mvhd" {
+				return true, nil
+			}
+
+			// Read the version and then the timescale and duration, which are 64-bit in version 1.
+			var buf [32]byte
+			body := buf[:]
+			if n := b.size - b.headerLen; n < int64(len(buf)) {
+				body = buf[:n]
+			}
+			if len(body) < 20 {
+				return false, errNotMP4
+			}
+			if _, err := ra.ReadAt(body, b.off+b.headerLen); err != nil {
+				return false, err
+			}
+			var timescale, units uint64
+			if body[0] == 1 {
+				if len(body) < 32 {
+					return false, errNotMP4
+				}
+				timescale = uint64(binary.BigEndian.Uint32(body[20:24]))
+				units = binary.BigEndian.Uint64(body[24:32])
+			} else {
+				timescale = uint64(binary.BigEndian.Uint32(body[12:16]))
+				units = uint64(binary.BigEndian.Uint32(body[16:20]))
+			}
+			if timescale == 0 {
+				return false, errNotMP4
+			}
+			duration = time.Duration(float64(units) / float64(timescale) * float64(time.Second))
+			return false, nil
+		})
+	})
+	if err != nil || duration < 0 {
+		return 0, errNotMP4
+	}
+	return duration, nil
+}
+
+// Validate is used to validate the content is a mp4 with a movie header.
+func (p *mp4Validator) Validate(c *Content, _ string) error {
+	if isoBrands(c.Header()) == nil {
+		return errNotMP4
+	}
+	ra, size, err := c.Spool()
+	if err != nil {
+		return err
+	}
+	_, err = mp4Duration(ra, size)
+	return err
+}
+
+func init() {
+	Validators = append(Validators, &mp4Validator{})
+}
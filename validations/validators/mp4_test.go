@@ -0,0 +1,51 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// Builds a mp4 with a version 0 movie header of the duration in milliseconds.
+func testMP4(ms uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], ms)
+	return append(testFtyp("isom", "isom", "iso2"), testBox("moov", testBox("mvhd", mvhd))...)
+}
+
+func Test_mp4Duration(t *testing.T) {
+	valid := testMP4(10000)
+	v1 := make([]byte, 112)
+	v1[0] = 1
+	binary.BigEndian.PutUint32(v1[20:24], 10)
+	binary.BigEndian.PutUint64(v1[24:32], 25)
+	hostile := testMP4(10000)
+	binary.BigEndian.PutUint32(hostile[24:28], 0x7fffffff)
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		wantErr  bool
+	}{
+		{"version 0", valid, 10 * time.Second, false},
+		{"version 1", append(testFtyp("isom"), testBox("moov", testBox("mvhd", v1))...), 2500 * time.Millisecond, false},
+		{"zero", testMP4(0), 0, false},
+		{"no ftyp", testBox("moov", testBox("mvhd", make([]byte, 100))), 0, true},
+		{"no moov", testFtyp("isom"), 0, true},
+		{"no mvhd", append(testFtyp("isom"), testBox("moov")...), 0, true},
+		{"zero timescale", append(testFtyp("isom"), testBox("moov", testBox("mvhd", make([]byte, 100)))...), 0, true},
+		{"short mvhd", append(testFtyp("isom"), testBox("moov", testBox("mvhd", make([]byte, 12)))...), 0, true},
+		{"truncated", valid[:len(valid)-1], 0, true},
+		{"hostile moov size", hostile, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := mp4Duration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if (err != nil) != tt.wantErr || duration != tt.duration {
+				t.Errorf("mp4Duration() = %v, %v, want %v, error %v", duration, err, tt.duration, tt.wantErr)
+			}
+		})
+	}
+}
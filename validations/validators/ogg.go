@@ -0,0 +1,97 @@
+package validators
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+type oggValidator struct{}
+
+var _ Validator = (*oggValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *oggValidator) Matches(s string) bool {
+	return s == "ogg"
+}
+
+var errNotOgg = errors.New("The audio specified is not an ogg")
+
+// Defines the CRC table for ogg pages. Ogg uses the 0x04C11DB7 polynomial without reflection, which
+// hash/crc32 does not support.
+var oggCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04C11DB7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return
+}()
+
+// Defines the identification packet prefixes of the supported codecs.
+var oggCodecs = [][]byte{
+	[]byte("\x01vorbis"),
+	[]byte("OpusHead"),
+	[]byte("\x7fFLAC"),
+	[]byte("Speex   "),
+}
+
+// Validate is used to validate the content is an ogg. This checks the first page is intact and
+// starts a stream of a supported audio codec.
+func (p *oggValidator) Validate(c *Content, _ string) error {
+	br := bufio.NewReader(c.Open())
+	var header [27]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return errNotOgg
+	}
+	if string(header[:4]) != "OggS" || header[4] != 0 || header[5]&0x02 == 0 {
+		return errNotOgg
+	}
+
+	// Read the segment table and the data.
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(br, segments); err != nil {
+		return errNotOgg
+	}
+	dataLen := 0
+	for _, v := range segments {
+		dataLen += int(v)
+	}
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return errNotOgg
+	}
+
+	// Check the CRC, which is calculated with the CRC field set to zero.
+	want := binary.LittleEndian.Uint32(header[22:26])
+	binary.LittleEndian.PutUint32(header[22:26], 0)
+	crc := uint32(0)
+	for _, b := range [][]byte{header[:], segments, data} {
+		for _, v := range b {
+			crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^v]
+		}
+	}
+	if crc != want {
+		return errNotOgg
+	}
+
+	// Check the codec.
+	for _, v := range oggCodecs {
+		if bytes.HasPrefix(data, v) {
+			return nil
+		}
+	}
+	return errNotOgg
+}
+
+func init() {
+	Validators = append(Validators, &oggValidator{})
+}
@@ -0,0 +1,57 @@
+package validators
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// Builds the first page of an ogg stream with the data as one packet.
+func testOgg(data []byte) []byte {
+	segments := make([]byte, 0)
+	for n := len(data); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+	b := append([]byte("OggS\x00\x02"), make([]byte, 20)...)
+	b = append(append(append(b, byte(len(segments))), segments...), data...)
+	crc := uint32(0)
+	for _, v := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^v]
+	}
+	binary.LittleEndian.PutUint32(b[22:26], crc)
+	return b
+}
+
+func Test_oggValidator(t *testing.T) {
+	valid := testOgg(append([]byte("OpusHead"), make([]byte, 11)...))
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-1] = 1
+	hostile := append([]byte(nil), valid...)
+	hostile[26] = 255
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"opus", valid, true},
+		{"vorbis", testOgg(append([]byte("\x01vorbis"), make([]byte, 23)...)), true},
+		{"long packet", testOgg(append([]byte("\x7fFLAC"), make([]byte, 600)...)), true},
+		{"unknown codec", testOgg(append([]byte("\x80theora"), make([]byte, 35)...)), false},
+		{"bad crc", corrupt, false},
+		{"not first page", append([]byte("OggS\x00\x00"), valid[6:]...), false},
+		{"truncated", valid[:len(valid)-1], false},
+		{"truncated header", valid[:20], false},
+		{"hostile segment count", hostile, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &oggValidator{}, "ogg", tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package validators
+
+import (
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+type pdfValidator struct{}
+
+var _ Validator = (*pdfValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *pdfValidator) Matches(s string) bool {
+	return s == "pdf"
+}
+
+var (
+	errNotPDF = errors.New("The document specified is not a pdf")
+
+	pdfVersionRegex   = regexp.MustCompile(`%PDF-\d\.\d`)
+	pdfStartXrefRegex = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`)
+	pdfXrefRegex      = regexp.MustCompile(`^\s*(?:xref|\d+\s+\d+\s+obj)`)
+)
+
+// Checks the pdf header, trailer and that the cross-reference offset points to a cross-reference.
+func checkPDF(c *Content) (io.ReaderAt, int64, error) {
+	// PDF readers allow up to 1024 bytes of junk before the header, so offsets are relative to it.
+	h := c.Header()
+	if len(h) > 1024 {
+		h = h[:1024]
+	}
+	loc := pdfVersionRegex.FindIndex(h)
+	if loc == nil {
+		return nil, 0, errNotPDF
+	}
+	base := int64(loc[0])
+
+	// Read the end of the file and find the last cross-reference offset.
+	ra, size, err := c.Spool()
+	if err != nil {
+		return nil, 0, err
+	}
+	tailLen := int64(2048)
+	if size < tailLen {
+		tailLen = size
+	}
+	tail := make([]byte, tailLen)
+	if _, err = ra.ReadAt(tail, size-tailLen); err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	matches := pdfStartXrefRegex.FindAllSubmatch(tail, -1)
+	if matches == nil {
+		return nil, 0, errNotPDF
+	}
+	xref, err := strconv.ParseInt(string(matches[len(matches)-1][1]), 10, 64)
+	if err != nil || base+xref >= size {
+		return nil, 0, errNotPDF
+	}
+
+	// Make sure there is a cross-reference table or stream there.
+	b := make([]byte, 64)
+	n, err := ra.ReadAt(b, base+xref)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	if !pdfXrefRegex.Match(b[:n]) {
+		return nil, 0, errNotPDF
+	}
+	return ra, size, nil
+}
+
+// Validate is used to validate the content is a pdf.
+func (p *pdfValidator) Validate(c *Content, _ string) error {
+	_, _, err := checkPDF(c)
+	return err
+}
+
+type maxPagesValidator struct{}
+
+var _ Validator = (*maxPagesValidator)(nil)
+
+var maxPagesRegex = regexp.MustCompile(`^max-pages=(\d+)$`)
+
+// Matches is used to check if a validator matches a string.
+func (p *maxPagesValidator) Matches(s string) bool {
+	m := maxPagesRegex.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	_, err := strconv.Atoi(m[1])
+	return err == nil
+}
+
+var (
+	pdfPageRegex   = regexp.MustCompile(`/Type\s{0,16}/Page\b`)
+	pdfObjStmRegex = regexp.MustCompile(`/Type\s{0,16}/ObjStm\b`)
+	pdfStreamRegex = regexp.MustCompile(`stream\r?\n`)
+)
+
+// Defines the most that will be inflated from all of the object streams of a pdf, and how many object
+// streams will be inflated.
+const (
+	pdfMaxInflatedSize = 256 * 1024 * 1024
+	pdfMaxObjStms      = 10000
+)
+
+var errPDFTooComplex = errors.New("The pdf specified has too many compressed objects")
+
+// Counts the page objects in a pdf. Page objects can be inside compressed object streams, so if the
+// reader at is specified, object streams are inflated and counted too. This is a scan rather than a
+// full parse, so it can over count if pages were replaced by an incremental update. Returns
+// errPDFTooComplex if the object streams are too many or inflate to too much.
+func countPDFPages(r io.Reader, ra io.ReaderAt, size int64) (int, error) {
+	const (
+		chunkSize = 1024 * 1024
+		overlap   = 256
+	)
+	buf := make([]byte, chunkSize+overlap)
+	pages := 0
+	carry := 0
+	pos := int64(0)
+	inflated, objStms := int64(0), 0
+	for {
+		n, err := io.ReadFull(r, buf[carry:])
+		data := buf[:carry+n]
+		final := err != nil
+
+		// Only count matches that start before the overlap, since the overlap is scanned again.
+		limit := len(data) - overlap
+		if final {
+			limit = len(data)
+		}
+		for _, loc := range pdfPageRegex.FindAllIndex(data, -1) {
+			if loc[0] < limit {
+				pages++
+			}
+		}
+		if ra != nil {
+			for _, loc := range pdfObjStmRegex.FindAllIndex(data, -1) {
+				if loc[0] >= limit {
+					continue
+				}
+				stream := pdfStreamRegex.FindIndex(data[loc[1]:])
+				if stream == nil {
+					continue
+				}
+				off := pos + int64(loc[1]+stream[1])
+				zr, err := zlib.NewReader(io.NewSectionReader(ra, off, size-off))
+				if err != nil {
+					continue
+				}
+				if objStms++; objStms > pdfMaxObjStms {
+					return 0, errPDFTooComplex
+				}
+
+				// Read one byte past what is left so going over it can be told apart from reaching it.
+				lr := &io.LimitedReader{R: zr, N: pdfMaxInflatedSize - inflated + 1}
+				n, _ := countPDFPages(lr, nil, 0)
+				if lr.N == 0 {
+					return 0, errPDFTooComplex
+				}
+				inflated = pdfMaxInflatedSize + 1 - lr.N
+				pages += n
+			}
+		}
+		if final || limit <= 0 {
+			return pages, nil
+		}
+
+		// Move the overlap to the start of the buffer.
+		carry = copy(buf, data[limit:])
+		pos += int64(limit)
+	}
+}
+
+// Validate is used to validate the content is a pdf with at most the number of pages specified.
+func (p *maxPagesValidator) Validate(c *Content, s string) error {
+	limit, _ := strconv.Atoi(maxPagesRegex.FindStringSubmatch(s)[1])
+	ra, size, err := checkPDF(c)
+	if err != nil {
+		return err
+	}
+	pages, err := countPDFPages(io.NewSectionReader(ra, 0, size), ra, size)
+	if err != nil {
+		return err
+	}
+	if pages == 0 {
+		return errors.New("The page count of the pdf specified could not be determined")
+	}
+	if pages > limit {
+		return fmt.Errorf("The pdf specified has more than %d pages", limit)
+	}
+	return nil
+}
+
+func init() {
+	Validators = append(Validators, &pdfValidator{}, &maxPagesValidator{})
+}
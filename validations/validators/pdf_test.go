@@ -0,0 +1,133 @@
+package validators
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Builds a pdf with the objects and a cross-reference table after them.
+func testPDF(objects ...string) []byte {
+	b := []byte("%PDF-1.7\n")
+	for i, v := range objects {
+		b = append(b, strconv.Itoa(i+1)+" 0 obj\n"+v+"\nendobj\n"...)
+	}
+	xref := len(b)
+	b = append(b, "xref\n0 1\n0000000000 65535 f \ntrailer\n<< /Root 1 0 R >>\n"...)
+	return append(b, "startxref\n"+strconv.Itoa(xref)+"\n%%EOF\n"...)
+}
+
+// Builds a compressed object stream with the data. Only Huffman coding is used, and the data is padded so
+// it is not stored as it is, so the data does not appear as it is in the pdf.
+func testObjStm(data io.Reader) string {
+	var buf bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&buf, zlib.HuffmanOnly)
+	_, _ = io.Copy(zw, io.MultiReader(strings.NewReader(strings.Repeat(" ", 4096)), data))
+	_ = zw.Close()
+	return "<< /Type /ObjStm /Filter /FlateDecode /Length " + strconv.Itoa(buf.Len()) + " >>\nstream\n" +
+		buf.String() + "\nendstream"
+}
+
+// Builds the page objects of a pdf with the number of pages.
+func testPDFPages(pages int) []string {
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Count " + strconv.Itoa(pages) + " >>"}
+	for i := 0; i < pages; i++ {
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R >>")
+	}
+	return objects
+}
+
+// Defines a reader of zeros.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func Test_pdfValidator(t *testing.T) {
+	valid := testPDF(testPDFPages(1)...)
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"pdf", valid, true},
+		{"junk before header", append([]byte("junk\n"), valid...), true},
+		{"not pdf", []byte("hello world"), false},
+		{"no trailer", valid[:bytes.Index(valid, []byte("startxref"))], false},
+		{"truncated", valid[:len(valid)-3], false},
+		{"bad offset", bytes.Replace(valid, []byte("startxref\n"), []byte("startxref\n1"), 1), false},
+		{"hostile offset", bytes.Replace(valid, []byte("startxref\n"), []byte("startxref\n99999999999999999999"), 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &pdfValidator{}, "pdf", tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func Test_maxPagesValidator(t *testing.T) {
+	compressed := testPDF("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Count 3 >>",
+		testObjStm(strings.NewReader(strings.Repeat("<< /Type /Page /Parent 2 0 R >>\n", 3))))
+	streams := make([]string, pdfMaxObjStms+1)
+	for i := range streams {
+		streams[i] = testObjStm(strings.NewReader("<< /Type /Page >>"))
+	}
+	tests := []struct {
+		name  string
+		data  []byte
+		rule  string
+		valid bool
+	}{
+		{"under", testPDF(testPDFPages(2)...), "max-pages=3", true},
+		{"at", testPDF(testPDFPages(3)...), "max-pages=3", true},
+		{"over", testPDF(testPDFPages(4)...), "max-pages=3", false},
+		{"object stream at", compressed, "max-pages=3", true},
+		{"object stream over", compressed, "max-pages=2", false},
+		{"no pages", testPDF("<< /Type /Catalog >>"), "max-pages=3", false},
+		{"truncated", testPDF(testPDFPages(1)...)[:100], "max-pages=3", false},
+		{"hostile object streams", testPDF(streams...), "max-pages=100000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateData(t, &maxPagesValidator{}, tt.rule, tt.data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func Test_maxPagesValidatorInflatedSize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("inflates too much for short mode")
+	}
+	tests := []struct {
+		name  string
+		size  int64
+		valid bool
+	}{
+		{"at", pdfMaxInflatedSize, true},
+		{"over", pdfMaxInflatedSize + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, _ := zlib.NewWriterLevel(&buf, zlib.BestSpeed)
+			_, _ = io.Copy(zw, io.LimitReader(zeros{}, tt.size))
+			_ = zw.Close()
+			data := testPDF("<< /Type /Page >>", "<< /Type /ObjStm >>\nstream\n"+buf.String()+"\nendstream")
+			err := validateData(t, &maxPagesValidator{}, "max-pages=1", data)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package validators
 import (
 	"errors"
 	"image/png"
-	"strings"
 )
 
 type pngValidator struct{}
@@ -15,13 +14,11 @@ func (p *pngValidator) Matches(s string) bool {
 	return s == "png"
 }
 
-// Validate is used to validate a byte slice is a png.
-func (p *pngValidator) Validate(b []byte, _ string) error {
-	_, err := png.Decode(strings.NewReader(string(b)))
-	if err != nil {
-		return errors.New("The image specified is not a png")
-	}
-	return nil
+var errNotPNG = errors.New("The image specified is not a png")
+
+// Validate is used to validate the content is a png.
+func (p *pngValidator) Validate(c *Content, _ string) error {
+	return decodeImage(c, png.DecodeConfig, png.Decode, errNotPNG)
 }
 
 func init() {
@@ -0,0 +1,48 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// Builds a png with only a header chunk for an image of the width and height.
+func testPNGHeader(width, height uint32) []byte {
+	b := []byte("\x89PNG\r\n\x1a\n")
+	chunk := []byte("IHDR")
+	chunk = binary.BigEndian.AppendUint32(chunk, width)
+	chunk = binary.BigEndian.AppendUint32(chunk, height)
+	chunk = append(chunk, 8, 6, 0, 0, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(chunk)-4))
+	b = append(b, chunk...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(chunk))
+}
+
+func Test_pngValidator(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"truncated", valid[:len(valid)-20], errNotPNG},
+		{"header only", testPNGHeader(4, 4), errNotPNG},
+		{"huge dimensions", testPNGHeader(100000, 100000), errImageTooLarge},
+		{"not png", []byte("GIF89a"), errNotPNG},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateData(t, &pngValidator{}, "png", tt.data); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"strings"
+)
+
+// Gets the name of the root element of a XML document, or a blank string if it is not XML.
+func xmlRootElement(b []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			return ""
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t.Name.Local
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) != 0 {
+				return ""
+			}
+		}
+	}
+}
+
+// DetectContentType is used to detect the content type from the header of the content. This extends
+// http.DetectContentType with the formats that the validators support but it does not detect.
+func DetectContentType(header []byte) string {
+	contentType := http.DetectContentType(header)
+	switch strings.SplitN(contentType, ";", 2)[0] {
+	case "text/xml", "text/plain":
+		if xmlRootElement(header) == "svg" {
+			return "image/svg+xml"
+		}
+	case "audio/wave":
+		return "audio/wav"
+	case "application/ogg":
+		if len(header) > 64 {
+			header = header[:64]
+		}
+		if bytes.Contains(header, []byte("OpusHead")) || bytes.Contains(header, []byte("\x01vorbis")) ||
+			bytes.Contains(header, []byte("\x7fFLAC")) || bytes.Contains(header, []byte("Speex   ")) {
+			return "audio/ogg"
+		}
+	case "application/octet-stream":
+		if brands := isoBrands(header); brands != nil {
+			switch {
+			case hasBrand(brands, "avif", "avis"):
+				return "image/avif"
+			case hasBrand(brands, "heic", "heix", "heim", "heis", "hevc", "hevx"):
+				return "image/heic"
+			case hasBrand(brands, "M4A "):
+				return "audio/mp4"
+			case hasBrand(brands, "qt  "):
+				return "video/quicktime"
+			default:
+				return "video/mp4"
+			}
+		}
+		if len(header) >= 4 {
+			if length, _ := parseMP3Header(header[:4]); length >= 4 {
+				return "audio/mpeg"
+			}
+		}
+	}
+	return contentType
+}
@@ -0,0 +1,29 @@
+package validators
+
+import "testing"
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"png", "\x89PNG\r\n\x1a\n", "image/png"},
+		{"svg", `<svg xmlns="http://www.w3.org/2000/svg"></svg>`, "image/svg+xml"},
+		{"svg with declaration", "<?xml version=\"1.0\"?>\n<!-- logo -->\n<svg></svg>", "image/svg+xml"},
+		{"xml", `<?xml version="1.0"?><feed></feed>`, "text/xml; charset=utf-8"},
+		{"html", `<html><svg></svg></html>`, "text/html; charset=utf-8"},
+		{"avif", "\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf", "image/avif"},
+		{"heic", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", "image/heic"},
+		{"mp4", "\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2", "video/mp4"},
+		{"mp3", "\xff\xfb\x90\x00", "audio/mpeg"},
+		{"text", "hello world", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentType([]byte(tt.header)); got != tt.want {
+				t.Errorf("DetectContentType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -14,12 +14,12 @@ func (p *svgValidator) Matches(s string) bool {
 	return s == "svg"
 }
 
-// Validate is used to validate a byte slice is a svg.
-func (p *svgValidator) Validate(b []byte, _ string) error {
+// Validate is used to validate the content is a svg.
+func (p *svgValidator) Validate(c *Content, _ string) error {
 	var doc struct {
 		XMLName xml.Name `xml:"svg"`
 	}
-	if err := xml.Unmarshal(b, &doc); err != nil {
+	if err := xml.NewDecoder(c.Open()).Decode(&doc); err != nil {
 		return errors.New("The image specified is not a svg")
 	}
 	return nil
@@ -0,0 +1,237 @@
+package validators
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type svgSafeValidator struct{}
+
+var _ Validator = (*svgSafeValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *svgSafeValidator) Matches(s string) bool {
+	return s == "svg-safe"
+}
+
+// Defines the namespaces that are used.
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Defines the namespaces that editors and metadata use. These are not rendered by browsers, so any
+// elements and attributes in them are allowed.
+var svgInertNamespaces = map[string]bool{
+	"http://www.inkscape.org/namespaces/inkscape":            true,
+	"http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd":     true,
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#":            true,
+	"http://creativecommons.org/ns#":                         true,
+	"http://purl.org/dc/elements/1.1/":                       true,
+	"http://www.bohemiancoding.com/sketch/ns":                true,
+	"http://ns.adobe.com/AdobeIllustrator/10.0/":             true,
+	"http://ns.adobe.com/AdobeSVGViewerExtensions/3.0/":      true,
+	"http://ns.adobe.com/Extensibility/1.0/":                 true,
+	"http://ns.adobe.com/Graphs/1.0/":                        true,
+	"http://ns.adobe.com/SaveForWeb/1.0/":                    true,
+	"http://ns.adobe.com/Variables/1.0/":                     true,
+	"http://ns.adobe.com/xap/1.0/":                           true,
+	"http://ns.adobe.com/ImageReplacement/1.0/":              true,
+	"http://ns.adobe.com/Flows/1.0/":                         true,
+	"http://ns.adobe.com/AdobeIllustrator/10.0/ns":           true,
+	"http://schemas.microsoft.com/visio/2003/SVGExtensions/": true,
+}
+
+// Defines the SVG elements that are allowed. Notably this excludes script, foreignObject, a, feImage and
+// the animation elements, since they can run script, embed HTML or navigate.
+var svgSafeElements = toSet(
+	"svg", "g", "defs", "symbol", "use", "title", "desc", "metadata", "style",
+	"path", "rect", "circle", "ellipse", "line", "polyline", "polygon", "image",
+	"text", "tspan", "textPath",
+	"linearGradient", "radialGradient", "stop", "clipPath", "mask", "pattern", "marker",
+	"filter", "feBlend", "feColorMatrix", "feComponentTransfer", "feComposite", "feConvolveMatrix",
+	"feDiffuseLighting", "feDisplacementMap", "feDistantLight", "feDropShadow", "feFlood", "feFuncA",
+	"feFuncB", "feFuncG", "feFuncR", "feGaussianBlur", "feMerge", "feMergeNode", "feMorphology",
+	"feOffset", "fePointLight", "feSpecularLighting", "feSpotLight", "feTile", "feTurbulence",
+)
+
+// Defines the attributes without a namespace that are allowed on any allowed element.
+var svgSafeAttributes = toSet(
+	// Core and styling.
+	"id", "class", "style", "lang", "version", "baseProfile", "viewBox", "preserveAspectRatio",
+	"width", "height", "x", "y", "transform", "transform-origin", "href",
+
+	// Geometry.
+	"x1", "y1", "x2", "y2", "cx", "cy", "r", "rx", "ry", "fx", "fy", "fr", "d", "points", "pathLength",
+
+	// Presentation.
+	"fill", "fill-opacity", "fill-rule", "stroke", "stroke-width", "stroke-linecap", "stroke-linejoin",
+	"stroke-miterlimit", "stroke-dasharray", "stroke-dashoffset", "stroke-opacity", "opacity", "color",
+	"display", "visibility", "overflow", "clip-path", "clip-rule", "mask", "filter", "marker-start",
+	"marker-mid", "marker-end", "stop-color", "stop-opacity", "flood-color", "flood-opacity",
+	"lighting-color", "color-interpolation", "color-interpolation-filters", "shape-rendering",
+	"text-rendering", "image-rendering", "paint-order", "vector-effect", "mix-blend-mode", "isolation",
+
+	// Text.
+	"font-family", "font-size", "font-size-adjust", "font-stretch", "font-style", "font-variant",
+	"font-weight", "text-anchor", "text-decoration", "dominant-baseline", "alignment-baseline",
+	"baseline-shift", "letter-spacing", "word-spacing", "writing-mode", "direction", "unicode-bidi",
+	"dx", "dy", "rotate", "textLength", "lengthAdjust", "startOffset", "method", "spacing", "side",
+
+	// Gradients, patterns, clipping, masking and markers.
+	"offset", "gradientUnits", "gradientTransform", "spreadMethod", "patternUnits",
+	"patternContentUnits", "patternTransform", "clipPathUnits", "maskUnits", "maskContentUnits",
+	"markerUnits", "markerWidth", "markerHeight", "refX", "refY", "orient",
+
+	// Filters.
+	"filterUnits", "primitiveUnits", "in", "in2", "result", "stdDeviation", "mode", "type", "values",
+	"operator", "k1", "k2", "k3", "k4", "scale", "xChannelSelector", "yChannelSelector",
+	"tableValues", "slope", "intercept", "amplitude", "exponent", "radius", "baseFrequency",
+	"numOctaves", "seed", "stitchTiles", "kernelMatrix", "kernelUnitLength", "order", "divisor",
+	"bias", "targetX", "targetY", "edgeMode", "preserveAlpha", "surfaceScale", "specularConstant",
+	"specularExponent", "diffuseConstant", "azimuth", "elevation", "z", "pointsAtX", "pointsAtY",
+	"pointsAtZ", "limitingConeAngle",
+)
+
+func toSet(s ...string) map[string]bool {
+	m := make(map[string]bool, len(s))
+	for _, v := range s {
+		m[v] = true
+	}
+	return m
+}
+
+var (
+	svgURLRegex       = regexp.MustCompile(`(?i)url\s*\(\s*['"]?\s*([^'")\s]*)`)
+	svgImageHrefRegex = regexp.MustCompile(`^data:image/(?:png|jpeg|gif|webp);base64,[A-Za-z0-9+/=\s]*$`)
+	svgDangerousCSS   = regexp.MustCompile(`(?i)@import|expression\s*\(|javascript:|behavior\s*:|-moz-binding`)
+)
+
+// Checks CSS only references fragments in the same document.
+func checkSVGCSS(css string) error {
+	if strings.Contains(css, "\\") || svgDangerousCSS.MatchString(css) {
+		return errors.New("The svg specified contains disallowed CSS")
+	}
+	for _, m := range svgURLRegex.FindAllStringSubmatch(css, -1) {
+		if !strings.HasPrefix(m[1], "#") {
+			return errors.New("The svg specified contains a CSS reference to another document")
+		}
+	}
+	return nil
+}
+
+// Checks a link only references a fragment in the same document, or is an inline raster image.
+func checkSVGHref(element, href string) error {
+	href = strings.TrimSpace(href)
+	if strings.HasPrefix(href, "#") {
+		return nil
+	}
+	if element == "image" && svgImageHrefRegex.MatchString(href) {
+		return nil
+	}
+	return fmt.Errorf("The svg specified contains a disallowed reference on a %q element", element)
+}
+
+// Checks an element and its attributes are allowed.
+func checkSVGElement(t xml.StartElement) error {
+	// Allow anything in the editor namespaces.
+	if svgInertNamespaces[t.Name.Space] {
+		return nil
+	}
+	if (t.Name.Space != svgNamespace && t.Name.Space != "") || !svgSafeElements[t.Name.Local] {
+		return fmt.Errorf("The svg specified contains a disallowed element %q", t.Name.Local)
+	}
+
+	for _, a := range t.Attr {
+		switch {
+		case a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns"):
+			// Namespace declarations are fine, since elements are checked against their namespace.
+			continue
+		case a.Name.Space == xlinkNamespace && a.Name.Local == "href", a.Name.Space == "" && a.Name.Local == "href":
+			if err := checkSVGHref(t.Name.Local, a.Value); err != nil {
+				return err
+			}
+			continue
+		case a.Name.Space == xlinkNamespace && (a.Name.Local == "title" || a.Name.Local == "type"):
+		case a.Name.Space == xmlNamespace || a.Name.Space == "xml":
+		case svgInertNamespaces[a.Name.Space]:
+			continue
+		case a.Name.Space != "" || !svgSafeAttributes[a.Name.Local]:
+			return fmt.Errorf("The svg specified contains a disallowed attribute %q", a.Name.Local)
+		}
+		if err := checkSVGCSS(a.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate is used to validate the content is a svg that only uses an allowlisted set of elements and
+// attributes, so that it cannot run script or load anything from another document.
+func (p *svgSafeValidator) Validate(c *Content, _ string) error {
+	d := xml.NewDecoder(c.Open())
+	depth := 0
+
+	// The text of a style element is collected until the element itself is closed, including the text of
+	// any elements in it, so that child elements cannot split the CSS.
+	styleDepth := 0
+	var style strings.Builder
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			if depth != 0 {
+				return errors.New("The image specified is not a svg")
+			}
+			return nil
+		}
+		if err != nil {
+			return errors.New("The image specified is not a svg")
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 && t.Name.Local != "svg" {
+				return errors.New("The image specified is not a svg")
+			}
+			if err = checkSVGElement(t); err != nil {
+				return err
+			}
+			depth++
+			if styleDepth == 0 && t.Name.Local == "style" {
+				styleDepth = depth
+				style.Reset()
+			}
+		case xml.EndElement:
+			// Check the CSS once the style element is closed, since comments can split the text.
+			if styleDepth != 0 && depth == styleDepth {
+				if err = checkSVGCSS(style.String()); err != nil {
+					return err
+				}
+				styleDepth = 0
+			}
+			depth--
+		case xml.CharData:
+			if styleDepth != 0 {
+				style.Write(t)
+			}
+		case xml.ProcInst:
+			if t.Target != "xml" {
+				return errors.New("The svg specified contains a disallowed processing instruction")
+			}
+		case xml.Directive:
+			// Allow a doctype, but not one with an internal subset since that can declare entities.
+			if !strings.HasPrefix(string(t), "DOCTYPE") || strings.ContainsAny(string(t), "[<") {
+				return errors.New("The svg specified contains a disallowed directive")
+			}
+		}
+	}
+}
+
+func init() {
+	Validators = append(Validators, &svgSafeValidator{})
+}
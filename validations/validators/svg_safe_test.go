@@ -0,0 +1,50 @@
+package validators
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_svgSafeValidator(t *testing.T) {
+	tests := []struct {
+		name string
+		svg  string
+		safe bool
+	}{
+		{"basic", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" fill="red"/></svg>`, true},
+		{"gradient", `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><defs><linearGradient id="a"><stop offset="0"/></linearGradient></defs><use xlink:href="#b"/><rect fill="url(#a)"/></svg>`, true},
+		{"doctype", `<?xml version="1.0"?><!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd"><svg xmlns="http://www.w3.org/2000/svg"/>`, true},
+		{"inkscape", `<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" inkscape:version="1.0"><inkscape:grid/></svg>`, true},
+		{"style", `<svg xmlns="http://www.w3.org/2000/svg"><style>.a { fill: url(#b) }</style></svg>`, true},
+		{"data image", `<svg xmlns="http://www.w3.org/2000/svg"><image href="data:image/png;base64,iVBORw0KGgo="/></svg>`, true},
+		{"not svg", `<html/>`, false},
+		{"script", `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`, false},
+		{"event handler", `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`, false},
+		{"javascript href", `<svg xmlns="http://www.w3.org/2000/svg"><use href="javascript:alert(1)"/></svg>`, false},
+		{"external use", `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="https://example.com/a.svg#a"/></svg>`, false},
+		{"external image", `<svg xmlns="http://www.w3.org/2000/svg"><image href="https://example.com/a.png"/></svg>`, false},
+		{"svg data image", `<svg xmlns="http://www.w3.org/2000/svg"><image href="data:image/svg+xml;base64,PHN2Zz4="/></svg>`, false},
+		{"foreign object", `<svg xmlns="http://www.w3.org/2000/svg"><foreignObject><div xmlns="http://www.w3.org/1999/xhtml"/></foreignObject></svg>`, false},
+		{"xhtml", `<svg xmlns="http://www.w3.org/2000/svg"><h:script xmlns:h="http://www.w3.org/1999/xhtml"/></svg>`, false},
+		{"css import", `<svg xmlns="http://www.w3.org/2000/svg"><style>@import "https://example.com/a.css";</style></svg>`, false},
+		{"css split by comment", `<svg xmlns="http://www.w3.org/2000/svg"><style>.a { fill: u<!-- -->rl(https://example.com/a) }</style></svg>`, false},
+		{"css split by child element", `<svg xmlns="http://www.w3.org/2000/svg"><style><desc/>@import url(https://example.com/a.css);</style></svg>`, false},
+		{"css after child element", `<svg xmlns="http://www.w3.org/2000/svg"><style>.a { fill: red }<desc>x</desc>.b { fill: url(https://example.com/a) }</style></svg>`, false},
+		{"css url attribute", `<svg xmlns="http://www.w3.org/2000/svg"><rect style="fill: url('https://example.com/a')"/></svg>`, false},
+		{"entity", `<!DOCTYPE svg [<!ENTITY a "b">]><svg xmlns="http://www.w3.org/2000/svg"/>`, false},
+		{"stylesheet", `<?xml-stylesheet href="https://example.com/a.css"?><svg xmlns="http://www.w3.org/2000/svg"/>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewContent(strings.NewReader(tt.svg), int64(len(tt.svg)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			err = (&svgSafeValidator{}).Validate(c, "svg-safe")
+			if (err == nil) != tt.safe {
+				t.Errorf("Validate() error = %v, want safe %v", err, tt.safe)
+			}
+		})
+	}
+}
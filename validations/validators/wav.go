@@ -0,0 +1,97 @@
+package validators
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+type wavValidator struct{}
+
+var _ Validator = (*wavValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *wavValidator) Matches(s string) bool {
+	return s == "wav"
+}
+
+var errNotWAV = errors.New("The audio specified is not a wav")
+
+// Walks the chunks of a wav of the size until the data chunk and returns the duration. The data itself is
+// not read, so the chunk lengths are checked against the size of the wav and the length the RIFF header
+// declares instead.
+func wavDuration(r io.Reader, size int64) (time.Duration, error) {
+	br := bufio.NewReader(r)
+	var buf [16]byte
+	if _, err := io.ReadFull(br, buf[:12]); err != nil {
+		return 0, errNotWAV
+	}
+	if string(buf[:4]) != "RIFF" || string(buf[8:12]) != "WAVE" {
+		return 0, errNotWAV
+	}
+	declared := int64(binary.LittleEndian.Uint32(buf[4:8]))
+	if declared+8 > size {
+		return 0, errNotWAV
+	}
+	remaining := declared - 4
+
+	byteRate := uint32(0)
+	for {
+		// Read the chunk header, and make sure the chunk fits in the rest of the wav.
+		if remaining < 8 {
+			return 0, errNotWAV
+		}
+		if _, err := io.ReadFull(br, buf[:8]); err != nil {
+			return 0, errNotWAV
+		}
+		remaining -= 8
+		id := string(buf[:4])
+		chunkLen := binary.LittleEndian.Uint32(buf[4:8])
+		if int64(chunkLen) > remaining {
+			return 0, errNotWAV
+		}
+		switch id {
+		case "fmt ":
+			// Read the format and make sure it is sane.
+			if chunkLen < 16 {
+				return 0, errNotWAV
+			}
+			if _, err := io.ReadFull(br, buf[:16]); err != nil {
+				return 0, errNotWAV
+			}
+			channels := binary.LittleEndian.Uint16(buf[2:4])
+			sampleRate := binary.LittleEndian.Uint32(buf[4:8])
+			byteRate = binary.LittleEndian.Uint32(buf[8:12])
+			if channels == 0 || sampleRate == 0 || byteRate == 0 {
+				return 0, errNotWAV
+			}
+			chunkLen -= 16
+			remaining -= 16
+		case "data":
+			// The format has to come before the data.
+			if byteRate == 0 {
+				return 0, errNotWAV
+			}
+			return time.Duration(float64(chunkLen) / float64(byteRate) * float64(time.Second)), nil
+		}
+
+		// Skip the rest of the chunk. Chunks are padded to an even length.
+		skip := int64(chunkLen) + int64(chunkLen&1)
+		if _, err := br.Discard(int(skip)); err != nil {
+			return 0, errNotWAV
+		}
+		remaining -= skip
+	}
+}
+
+// Validate is used to validate the content is a wav.
+func (p *wavValidator) Validate(c *Content, _ string) error {
+	_, err := wavDuration(c.Open(), c.Size())
+	return err
+}
+
+func init() {
+	Validators = append(Validators, &wavValidator{})
+}
@@ -0,0 +1,52 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// Builds a mono 16-bit 8kHz wav with data of the length, so each second is 16000 bytes.
+func testWAV(dataLen int) []byte {
+	format := []byte("\x01\x00\x01\x00\x40\x1f\x00\x00\x80\x3e\x00\x00\x02\x00\x10\x00")
+	return testRIFF("WAVE", testChunk("fmt ", format), testChunk("data", make([]byte, dataLen)))
+}
+
+func Test_wavDuration(t *testing.T) {
+	valid := testWAV(16000)
+	overrun := testWAV(16000)
+	binary.LittleEndian.PutUint32(overrun[40:44], 16002)
+	hostile := testWAV(16000)
+	binary.LittleEndian.PutUint32(hostile[40:44], 0xffffffff)
+	declared := testWAV(16000)
+	binary.LittleEndian.PutUint32(declared[4:8], 0xffffffff)
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		wantErr  bool
+	}{
+		{"one second", valid, time.Second, false},
+		{"half a second", testWAV(8000), time.Second / 2, false},
+		{"empty", testWAV(0), 0, false},
+		{"trailing data", append(testWAV(16000), make([]byte, 100)...), time.Second, false},
+		{"no format", testRIFF("WAVE", testChunk("data", make([]byte, 16000))), 0, true},
+		{"no data", testRIFF("WAVE", testChunk("fmt ", valid[20:36])), 0, true},
+		{"zero byte rate", testRIFF("WAVE", testChunk("fmt ", make([]byte, 16)), testChunk("data", nil)), 0, true},
+		{"not wav", testRIFF("WEBP", testChunk("VP8L", make([]byte, 10))), 0, true},
+		{"truncated", valid[:len(valid)-1], 0, true},
+		{"truncated header", valid[:10], 0, true},
+		{"data past chunk", overrun, 0, true},
+		{"hostile data length", hostile, 0, true},
+		{"hostile riff length", declared, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := wavDuration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if (err != nil) != tt.wantErr || duration != tt.duration {
+				t.Errorf("wavDuration() = %v, %v, want %v, error %v", duration, err, tt.duration, tt.wantErr)
+			}
+		})
+	}
+}
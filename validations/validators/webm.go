@@ -0,0 +1,206 @@
+package validators
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+type webmValidator struct{}
+
+var _ Validator = (*webmValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *webmValidator) Matches(s string) bool {
+	return s == "webm"
+}
+
+// Defines the EBML element IDs that are used.
+const (
+	ebmlIDHeader        = 0x1A45DFA3
+	ebmlIDDocType       = 0x4282
+	ebmlIDSegment       = 0x18538067
+	ebmlIDInfo          = 0x1549A966
+	ebmlIDTimecodeScale = 0x2AD7B1
+	ebmlIDDuration      = 0x4489
+	ebmlIDCluster       = 0x1F43B675
+)
+
+var errNotWebM = errors.New("The video specified is not a webm")
+
+// Defines an element in an EBML document. The size is -1 if it is unknown.
+type ebmlElement struct {
+	id      uint64
+	dataOff int64
+	size    int64
+}
+
+// Reads an EBML variable length integer. IDs keep the length marker, whereas sizes do not.
+func readEBMLVint(ra io.ReaderAt, off int64, keepMarker bool) (val uint64, n int, unknown bool, err error) {
+	var buf [8]byte
+	if _, err = ra.ReadAt(buf[:1], off); err != nil {
+		return
+	}
+	n = bits.LeadingZeros8(buf[0]) + 1
+	if n > 8 {
+		return 0, 0, false, errNotWebM
+	}
+	if n > 1 {
+		if _, err = ra.ReadAt(buf[1:n], off+1); err != nil {
+			return
+		}
+	}
+	val = uint64(buf[0])
+	if !keepMarker {
+		val &= 0xff >> n
+	}
+	for i := 1; i < n; i++ {
+		val = val<<8 | uint64(buf[i])
+	}
+	unknown = !keepMarker && val == 1<<(7*n)-1
+	return
+}
+
+// Walks the EBML elements between start and end, calling the function for each element. Returning
+// false from the function stops the walk. Elements with an unknown size can only be the last element.
+func walkEBML(ra io.ReaderAt, start, end int64, fn func(e ebmlElement) (bool, error)) error {
+	for off := start; off < end; {
+		id, idLen, _, err := readEBMLVint(ra, off, true)
+		if err != nil {
+			return err
+		}
+		size, sizeLen, unknown, err := readEBMLVint(ra, off+int64(idLen), false)
+		if err != nil {
+			return err
+		}
+		e := ebmlElement{id: id, dataOff: off + int64(idLen+sizeLen), size: int64(size)}
+		if unknown {
+			e.size = -1
+		} else if size > uint64(end-e.dataOff) {
+			return errNotWebM
+		}
+		cont, err := fn(e)
+		if err != nil || !cont || unknown {
+			return err
+		}
+		off = e.dataOff + e.size
+	}
+	return nil
+}
+
+// Reads the data of an element.
+func readEBMLData(ra io.ReaderAt, e ebmlElement) ([]byte, error) {
+	if e.size < 0 || e.size > 8 {
+		return nil, errNotWebM
+	}
+	b := make([]byte, e.size)
+	_, err := ra.ReadAt(b, e.dataOff)
+	return b, err
+}
+
+// Gets the duration of a webm. Returns -1 if the webm does not specify the duration.
+func webmDuration(ra io.ReaderAt, size int64) (time.Duration, error) {
+	// Check the EBML header is for a webm.
+	docType := ""
+	segmentOff := int64(-1)
+	err := walkEBML(ra, 0, size, func(e ebmlElement) (bool, error) {
+		if e.id != ebmlIDHeader || e.size < 0 {
+			return false, errNotWebM
+		}
+		segmentOff = e.dataOff + e.size
+		return false, walkEBML(ra, e.dataOff, e.dataOff+e.size, func(e ebmlElement) (bool, error) {
+			if e.id == ebmlIDDocType && e.size >= 0 && e.size <= 16 {
+				b := make([]byte, e.size)
+				if _, err := ra.ReadAt(b, e.dataOff); err != nil {
+					return false, err
+				}
+				docType = string(b)
+				return false, nil
+			}
+			return true, nil
+		})
+	})
+	if err != nil || docType != "webm" {
+		return 0, errNotWebM
+	}
+
+	// Find the info element in the segment.
+	duration := time.Duration(-1)
+	foundSegment := false
+	err = walkEBML(ra, segmentOff, size, func(e ebmlElement) (bool, error) {
+		if e.id != ebmlIDSegment {
+			return true, nil
+		}
+		foundSegment = true
+		end := size
+		if e.size >= 0 {
+			end = e.dataOff + e.size
+		}
+		return false, walkEBML(ra, e.dataOff, end, func(e ebmlElement) (bool, error) {
+			if e.id == ebmlIDCluster {
+				// The info element always comes before the clusters.
+				return false, nil
+			}
+			if e.id != ebmlIDInfo || e.size < 0 {
+				return true, nil
+			}
+			scale := uint64(1000000)
+			units := -1.0
+			err := walkEBML(ra, e.dataOff, e.dataOff+e.size, func(e ebmlElement) (bool, error) {
+				switch e.id {
+				case ebmlIDTimecodeScale:
+					b, err := readEBMLData(ra, e)
+					if err != nil {
+						return false, err
+					}
+					scale = 0
+					for _, v := range b {
+						scale = scale<<8 | uint64(v)
+					}
+				case ebmlIDDuration:
+					b, err := readEBMLData(ra, e)
+					if err != nil {
+						return false, err
+					}
+					switch len(b) {
+					case 4:
+						units = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+					case 8:
+						units = math.Float64frombits(binary.BigEndian.Uint64(b))
+					default:
+						return false, errNotWebM
+					}
+				}
+				return true, nil
+			})
+			if err == nil && units >= 0 {
+				duration = time.Duration(units * float64(scale))
+			}
+			return false, err
+		})
+	})
+	if err != nil || !foundSegment {
+		return 0, errNotWebM
+	}
+	return duration, nil
+}
+
+// Validate is used to validate the content is a webm.
+func (p *webmValidator) Validate(c *Content, _ string) error {
+	if h := c.Header(); len(h) < 4 || binary.BigEndian.Uint32(h) != ebmlIDHeader {
+		return errNotWebM
+	}
+	ra, size, err := c.Spool()
+	if err != nil {
+		return err
+	}
+	_, err = webmDuration(ra, size)
+	return err
+}
+
+func init() {
+	Validators = append(Validators, &webmValidator{})
+}
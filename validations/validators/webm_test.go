@@ -0,0 +1,65 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// Builds an EBML element with the ID, which includes its length marker, and a one byte size.
+func testEBML(id uint32, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	b := binary.BigEndian.AppendUint32(nil, id)
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return append(append(b, 0x80|byte(len(body))), body...)
+}
+
+// Builds a webm with the duration in milliseconds, using the default timecode scale.
+func testWebM(ms float64) []byte {
+	duration := binary.BigEndian.AppendUint64(nil, math.Float64bits(ms))
+	return append(
+		testEBML(ebmlIDHeader, testEBML(ebmlIDDocType, []byte("webm"))),
+		testEBML(ebmlIDSegment, testEBML(ebmlIDInfo,
+			testEBML(ebmlIDTimecodeScale, []byte{0x0f, 0x42, 0x40}),
+			testEBML(ebmlIDDuration, duration)))...,
+	)
+}
+
+func Test_webmDuration(t *testing.T) {
+	valid := testWebM(10000)
+	header := testEBML(ebmlIDHeader, testEBML(ebmlIDDocType, []byte("webm")))
+	float32Duration := binary.BigEndian.AppendUint32(nil, math.Float32bits(2500))
+	unknown := append(append([]byte(nil), header...), 0x18, 0x53, 0x80, 0x67, 0xff)
+	unknown = append(unknown, testEBML(ebmlIDInfo, testEBML(ebmlIDDuration, float32Duration))...)
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		wantErr  bool
+	}{
+		{"duration", valid, 10 * time.Second, false},
+		{"unknown segment size", unknown, 2500 * time.Millisecond, false},
+		{"no duration", append(header, testEBML(ebmlIDSegment, testEBML(ebmlIDInfo))...), -1, false},
+		{"info after cluster", append(header, testEBML(ebmlIDSegment, testEBML(ebmlIDCluster),
+			testEBML(ebmlIDInfo, testEBML(ebmlIDDuration, float32Duration)))...), -1, false},
+		{"matroska", append(testEBML(ebmlIDHeader, testEBML(ebmlIDDocType, []byte("matroska"))), valid[len(header):]...), 0, true},
+		{"no segment", header, 0, true},
+		{"bad duration length", append(header, testEBML(ebmlIDSegment, testEBML(ebmlIDInfo, testEBML(ebmlIDDuration, []byte{1, 2})))...), 0, true},
+		{"truncated", valid[:len(valid)-1], 0, true},
+		{"truncated header", valid[:5], 0, true},
+		{"hostile size", append(append([]byte(nil), header...), 0x18, 0x53, 0x80, 0x67, 0x01, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe), 0, true},
+		{"hostile vint", append(append([]byte(nil), header...), 0x00, 0x00), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := webmDuration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if (err != nil) != tt.wantErr || duration != tt.duration {
+				t.Errorf("webmDuration() = %v, %v, want %v, error %v", duration, err, tt.duration, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package validators
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	// Registers webp with the image package so the dimension validators can read webp images.
+	_ "golang.org/x/image/webp"
+)
+
+type webpValidator struct{}
+
+var _ Validator = (*webpValidator)(nil)
+
+// Matches is used to check if a validator matches a string.
+func (p *webpValidator) Matches(s string) bool {
+	return s == "webp"
+}
+
+var errNotWebP = errors.New("The image specified is not a webp")
+
+// Walks the chunks of a webp and returns the number of frames. Still images have one frame.
+func webpFrames(ra io.ReaderAt, size int64) (int, error) {
+	// Check the RIFF header.
+	var buf [18]byte
+	if _, err := ra.ReadAt(buf[:12], 0); err != nil {
+		return 0, errNotWebP
+	}
+	if string(buf[:4]) != "RIFF" || string(buf[8:12]) != "WEBP" {
+		return 0, errNotWebP
+	}
+	end := int64(binary.LittleEndian.Uint32(buf[4:8])) + 8
+	if end > size {
+		return 0, errNotWebP
+	}
+
+	// Walk the chunks. The first chunk must describe the image.
+	frames := 0
+	for off := int64(12); off < end; {
+		if end-off < 8 {
+			return 0, errNotWebP
+		}
+		if _, err := ra.ReadAt(buf[:8], off); err != nil {
+			return 0, errNotWebP
+		}
+		fourCC := string(buf[:4])
+		chunkLen := int64(binary.LittleEndian.Uint32(buf[4:8]))
+		if chunkLen > end-off-8 {
+			return 0, errNotWebP
+		}
+		body := buf[:0]
+		if chunkLen >= 10 {
+			body = buf[8:18]
+			if _, err := ra.ReadAt(body, off+8); err != nil {
+				return 0, errNotWebP
+			}
+		}
+		switch fourCC {
+		case "VP8 ":
+			// Check the start code of the key frame.
+			if off == 12 && (len(body) < 10 || body[3] != 0x9d || body[4] != 0x01 || body[5] != 0x2a) {
+				return 0, errNotWebP
+			}
+			frames = 1
+		case "VP8L":
+			// Check the lossless signature.
+			if off == 12 && (len(body) < 5 || body[0] != 0x2f) {
+				return 0, errNotWebP
+			}
+			frames = 1
+		case "VP8X":
+			if off != 12 || chunkLen != 10 {
+				return 0, errNotWebP
+			}
+		case "ANMF":
+			frames++
+		default:
+			if off == 12 {
+				return 0, errNotWebP
+			}
+		}
+
+		// Chunks are padded to an even length.
+		off += 8 + chunkLen + chunkLen&1
+	}
+	if frames == 0 {
+		return 0, errNotWebP
+	}
+	return frames, nil
+}
+
+// Validate is used to validate the content is a webp.
+func (p *webpValidator) Validate(c *Content, _ string) error {
+	if h := c.Header(); len(h) < 12 || string(h[:4]) != "RIFF" || string(h[8:12]) != "WEBP" {
+		return errNotWebP
+	}
+	ra, size, err := c.Spool()
+	if err != nil {
+		return err
+	}
+	_, err = webpFrames(ra, size)
+	return err
+}
+
+func init() {
+	Validators = append(Validators, &webpValidator{})
+}
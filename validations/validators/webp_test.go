@@ -0,0 +1,67 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Builds a RIFF chunk, padded to an even length.
+func testChunk(id string, data []byte) []byte {
+	b := binary.LittleEndian.AppendUint32([]byte(id), uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// Builds a RIFF file of the form with the chunks.
+func testRIFF(form string, chunks ...[]byte) []byte {
+	body := bytes.Join(chunks, nil)
+	b := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)+4))
+	return append(append(b, form...), body...)
+}
+
+// Builds a webp with the number of frames. Still images have one frame.
+func testWebP(frames int) []byte {
+	lossless := []byte("\x2f\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	if frames == 1 {
+		return testRIFF("WEBP", testChunk("VP8L", lossless))
+	}
+	chunks := [][]byte{testChunk("VP8X", make([]byte, 10)), testChunk("ANIM", make([]byte, 6))}
+	for i := 0; i < frames; i++ {
+		chunks = append(chunks, testChunk("ANMF", append(make([]byte, 16), testChunk("VP8L", lossless)...)))
+	}
+	return testRIFF("WEBP", chunks...)
+}
+
+func Test_webpFrames(t *testing.T) {
+	valid := testWebP(3)
+	hostile := testRIFF("WEBP", testChunk("VP8L", []byte("\x2f\x00\x00\x00\x00\x00\x00\x00\x00\x00")))
+	binary.LittleEndian.PutUint32(hostile[16:20], 0xffffffff)
+	tests := []struct {
+		name   string
+		data   []byte
+		frames int
+	}{
+		{"lossless", testWebP(1), 1},
+		{"lossy", testRIFF("WEBP", testChunk("VP8 ", []byte("\x00\x00\x00\x9d\x01\x2a\x01\x00\x01\x00"))), 1},
+		{"animated", valid, 3},
+		{"no frames", testRIFF("WEBP", testChunk("VP8X", make([]byte, 10))), 0},
+		{"bad key frame", testRIFF("WEBP", testChunk("VP8 ", make([]byte, 10))), 0},
+		{"unknown first chunk", testRIFF("WEBP", testChunk("EXIF", make([]byte, 10))), 0},
+		{"not webp", testRIFF("WAVE", testChunk("VP8L", make([]byte, 10))), 0},
+		{"truncated", valid[:len(valid)-1], 0},
+		{"truncated header", valid[:10], 0},
+		{"hostile chunk length", hostile, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := webpFrames(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if (err != nil) != (tt.frames == 0) || frames != tt.frames {
+				t.Errorf("webpFrames() = %v, %v, want %v", frames, err, tt.frames)
+			}
+		})
+	}
+}
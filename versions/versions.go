@@ -0,0 +1,98 @@
+package versions
+
+import (
+	"context"
+	"log/slog"
+
+	"contenttruck/db"
+	"contenttruck/storage"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Defines how many versions are deleted at a time when a partition is deleted.
+const deleteBatchSize = 1000
+
+// Store is used to keep previous versions of files and delete them.
+type Store struct {
+	DB     *db.DB
+	S3     *s3.S3
+	Bucket string
+}
+
+// Save is used to copy the current version of a file of the size to a new version. The version is
+// deleted again if the copy fails.
+func (s *Store) Save(ctx context.Context, partition *db.Partition, path string, size int64) (*db.Version, error) {
+	// Record the version first so the copy is never orphaned.
+	v, err := s.DB.InsertVersion(ctx, partition.Name, path, size)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.Copy(ctx, s.S3, s.Bucket, path, v.Key(), s3.ObjectCannedACLPrivate, size)
+	if err != nil {
+		if err2 := s.DB.DeleteVersions(context.WithoutCancel(ctx), []int64{v.ID}); err2 != nil {
+			slog.Error("Error forgetting version", "err", err2, "id", v.ID)
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// Delete is used to delete versions forever. Returns the total size of the versions that were deleted,
+// which should be released from the partition. Versions that could not be deleted are kept.
+func (s *Store) Delete(ctx context.Context, versions []*db.Version) (int64, error) {
+	byKey := make(map[string]*db.Version, len(versions))
+	keys := make([]string, len(versions))
+	for i, v := range versions {
+		keys[i] = v.Key()
+		byKey[keys[i]] = v
+	}
+	deleted, err := storage.Delete(ctx, s.S3, s.Bucket, keys)
+	if len(deleted) == 0 {
+		return 0, err
+	}
+	var freed int64
+	ids := make([]int64, len(deleted))
+	for i, k := range deleted {
+		ids[i] = byKey[k].ID
+		freed += byKey[k].Size
+	}
+	if err2 := s.DB.DeleteVersions(ctx, ids); err2 != nil {
+		return 0, err2
+	}
+	return freed, err
+}
+
+// Prune is used to delete the versions of a file beyond how many the partition keeps. Returns the total
+// size that was deleted.
+func (s *Store) Prune(ctx context.Context, partition *db.Partition, path string) (int64, error) {
+	versions, err := s.DB.ListVersions(ctx, partition.Name, path, partition.Versions)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return s.Delete(ctx, versions)
+}
+
+// DeletePath is used to delete every version of a file. Returns the total size that was deleted.
+func (s *Store) DeletePath(ctx context.Context, partition *db.Partition, path string) (int64, error) {
+	versions, err := s.DB.ListVersions(ctx, partition.Name, path, 0)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return s.Delete(ctx, versions)
+}
+
+// DeletePartition is used to delete every version of the files of a partition. Returns how many were
+// deleted.
+func (s *Store) DeletePartition(ctx context.Context, partition string) (int, error) {
+	n := 0
+	for {
+		versions, err := s.DB.ListPartitionVersions(ctx, partition, deleteBatchSize)
+		if err != nil || len(versions) == 0 {
+			return n, err
+		}
+		if _, err = s.Delete(ctx, versions); err != nil {
+			return n, err
+		}
+		n += len(versions)
+	}
+}